@@ -0,0 +1,176 @@
+package git_backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveFormat selects how ArchiveRepository compresses a backup.
+type ArchiveFormat string
+
+const (
+	ArchiveNone   ArchiveFormat = "none"
+	ArchiveTarGz  ArchiveFormat = "targz"
+	ArchiveTarZst ArchiveFormat = "tarzst"
+)
+
+// ParseArchiveFormat validates the value of -backup.archive.
+func ParseArchiveFormat(value string) (ArchiveFormat, error) {
+	switch format := ArchiveFormat(value); format {
+	case ArchiveNone, ArchiveTarGz, ArchiveTarZst:
+		return format, nil
+	case "":
+		return ArchiveNone, nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q, expected none, targz or tarzst", value)
+	}
+}
+
+// DefaultLevel is the compression level of the format when -backup.archive-level
+// is not set.
+func (f ArchiveFormat) DefaultLevel() int {
+	switch f {
+	case ArchiveTarGz:
+		return 6
+	case ArchiveTarZst:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// CheckLevel validates a compression level for the format: 1 to 9 for targz,
+// 1 to 22 for tarzst. 0 stands for DefaultLevel.
+func (f ArchiveFormat) CheckLevel(level int) error {
+	var maxLevel int
+	switch f {
+	case ArchiveTarGz:
+		maxLevel = gzip.BestCompression
+	case ArchiveTarZst:
+		maxLevel = 22
+	default:
+		return nil
+	}
+	if level < 0 || level > maxLevel {
+		return fmt.Errorf("compression level %d is out of range for %s, expected 1 to %d", level, f, maxLevel)
+	}
+	return nil
+}
+
+// Extension is the file extension of archives in this format.
+func (f ArchiveFormat) Extension() string {
+	switch f {
+	case ArchiveTarGz:
+		return ".tar.gz"
+	case ArchiveTarZst:
+		return ".tar.zst"
+	default:
+		return ""
+	}
+}
+
+// ArchiveRepository writes srcDir as a compressed tarball to destFile. The
+// entries are prefixed with the name of srcDir, so extracting the archive
+// recreates the repository folder. The archive is written next to destFile
+// first and only renamed into place once complete, so a failed run never
+// leaves a partial archive behind under the final name. level is the
+// compression level, see CheckLevel.
+func ArchiveRepository(srcDir, destFile string, format ArchiveFormat, level int) (err error) {
+	if level == 0 {
+		level = format.DefaultLevel()
+	}
+	tmpFile := destFile + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(tmpFile)
+		}
+	}()
+
+	var compressed io.WriteCloser
+	switch format {
+	case ArchiveTarGz:
+		if compressed, err = gzip.NewWriterLevel(file, level); err != nil {
+			return err
+		}
+	case ArchiveTarZst:
+		if compressed, err = zstd.NewWriter(file, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot archive in format %q", format)
+	}
+	archive := tar.NewWriter(compressed)
+	if err = writeTar(archive, srcDir); err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	if err = compressed.Close(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, destFile)
+}
+
+func writeTar(archive *tar.Writer, srcDir string) error {
+	parent := filepath.Dir(filepath.Clean(srcDir))
+	return filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(parent, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyInto(archive, path)
+	})
+}
+
+func copyInto(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,151 @@
+package git_backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArchiveRepositoryRoundTrip(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "my-repo")
+	files := map[string]string{
+		"README.md":          "# my-repo\n",
+		"src/main.go":        "package main\n",
+		"src/nested/data.md": "nested\n",
+		"empty.txt":          "",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []ArchiveFormat{ArchiveTarGz, ArchiveTarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			destFile := filepath.Join(t.TempDir(), "my-repo"+format.Extension())
+			if err := ArchiveRepository(srcDir, destFile, format, 0); err != nil {
+				t.Fatalf("ArchiveRepository() error = %v", err)
+			}
+			if _, err := os.Stat(destFile + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("temporary archive was left behind: %v", err)
+			}
+			got := extractArchive(t, destFile, format)
+			want := make(map[string]string, len(files))
+			for name, content := range files {
+				want["my-repo/"+name] = content
+			}
+			if !maps.Equal(got, want) {
+				t.Errorf("extracted %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestArchiveRepositoryLevel(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "my-repo")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "README.md"), []byte("# my-repo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format ArchiveFormat
+		level  int
+		valid  bool
+	}{
+		{format: ArchiveTarGz, level: 1, valid: true},
+		{format: ArchiveTarGz, level: 9, valid: true},
+		{format: ArchiveTarGz, level: 10},
+		{format: ArchiveTarZst, level: 1, valid: true},
+		{format: ArchiveTarZst, level: 22, valid: true},
+		{format: ArchiveTarZst, level: 23},
+		{format: ArchiveTarZst, level: -1},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%d", test.format, test.level), func(t *testing.T) {
+			err := test.format.CheckLevel(test.level)
+			if test.valid != (err == nil) {
+				t.Fatalf("CheckLevel(%d) error = %v, want valid %t", test.level, err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			destFile := filepath.Join(t.TempDir(), "my-repo"+test.format.Extension())
+			if err := ArchiveRepository(srcDir, destFile, test.format, test.level); err != nil {
+				t.Fatalf("ArchiveRepository() error = %v", err)
+			}
+			if got := extractArchive(t, destFile, test.format); got["my-repo/README.md"] != "# my-repo\n" {
+				t.Errorf("extracted %v, want my-repo/README.md", got)
+			}
+		})
+	}
+}
+
+func TestArchiveRepositoryUnknownFormat(t *testing.T) {
+	destFile := filepath.Join(t.TempDir(), "my-repo.tar")
+	if err := ArchiveRepository(t.TempDir(), destFile, ArchiveNone, 0); err == nil {
+		t.Error("ArchiveRepository() error = nil, want an error for format none")
+	}
+	if _, err := os.Stat(destFile + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary archive was left behind: %v", err)
+	}
+}
+
+// extractArchive returns the regular files in the archive at path by name.
+func extractArchive(t *testing.T, path string, format ArchiveFormat) map[string]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var reader io.Reader
+	switch format {
+	case ArchiveTarGz:
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ArchiveTarZst:
+		zstdReader, err := zstd.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	}
+	files := make(map[string]string)
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// newLogHandler builds the slog handler selected with -log.level and -log.format.
+func newLogHandler(w io.Writer, level string, format string) (slog.Handler, error) {
+	var options slog.HandlerOptions
+	switch strings.ToLower(level) {
+	case "debug":
+		options.Level = slog.LevelDebug
+	case "info":
+		options.Level = slog.LevelInfo
+	case "warn", "warning":
+		options.Level = slog.LevelWarn
+	case "error":
+		options.Level = slog.LevelError
+	default:
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.NewTextHandler(w, &options), nil
+	case "json":
+		return slog.NewJSONHandler(w, &options), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// progressWriter logs the progress output of go-git at debug level. Only
+// finished steps, which end in a newline, are logged, the updates in between
+// end in a carriage return and are dropped.
+type progressWriter struct {
+	repo string
+	line []byte
+}
+
+// newProgressWriter returns the progress writer for repo, or nil to discard
+// the progress when -quiet is set or debug logging is off.
+func newProgressWriter(repo string) io.Writer {
+	if *quiet || !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return nil
+	}
+	return &progressWriter{repo: repo}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+	for {
+		end := bytes.IndexAny(w.line, "\r\n")
+		if end < 0 {
+			break
+		}
+		if message := strings.TrimSpace(string(w.line[:end])); w.line[end] == '\n' && message != "" {
+			slog.Debug("Progress", "repo", w.repo, "progress", message)
+		}
+		w.line = w.line[end+1:]
+	}
+	return len(p), nil
+}
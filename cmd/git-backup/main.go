@@ -1,23 +1,108 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"fmt"
 	gitbackup "git-backup"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 
 var configFilePath = flag.String("config.file", "git-backup.yml", "The path to your config file.")
+var configNoExpand = flag.Bool("config.no-expand", false, "Don't replace $VAR and ${VAR} in the config file with environment variables.")
 var targetPath = flag.String("backup.path", "backup", "The target path to the backup folder.")
 var failAtEnd = flag.Bool("backup.fail-at-end", false, "Fail at the end of backing up repositories, rather than right away.")
-var bareClone = flag.Bool("backup.bare-clone", false, "Make bare clones without checking out the main branch.")
+var depth = flag.Int("backup.depth", 0, "Only back up this many commits of history per branch. Shallow backups cannot be restored with git-backup restore. clone_options.depth takes precedence, and a job's depth over both. (0 backs up the full history)")
+var bareClone = flag.Bool("backup.bare-clone", false, "Make bare clones without checking out the main branch. Jobs can override this with bare_clone.")
+var prune = flag.Bool("backup.prune", false, "Remove branches and tags that were deleted upstream from bare clones. Jobs can override this with prune.")
+var dryRun = flag.Bool("backup.dry-run", false, "List the repositories that would be backed up and where, without cloning or writing anything. Notifications and reports are skipped unless -backup.dry-run-notify is set, monitor pings always are.")
+var dryRunNotify = flag.Bool("backup.dry-run-notify", false, "Send the notifications and write the reports of a dry run, to test them before the first real run.")
+var archiveFormat = flag.String("backup.archive", "none", "Also archive each backed up repository next to its folder: none, targz or tarzst.")
+var archiveLevel = flag.Int("backup.archive-level", 0, "The compression level of archives: 1 to 9 for targz, 1 to 22 for tarzst. (0 uses 6 for targz and 3 for tarzst)")
+var archiveRemove = flag.Bool("backup.archive-remove", false, "Remove the backup folder once it is archived. The next run clones the repository from scratch.")
+var retentionCount = flag.Int("backup.retention-count", 0, "Keep this many archives or snapshots of each repository, named with the time of the run. (0 keeps all)")
+var retentionAge = flag.Duration("backup.retention-age", 0, "Remove archives or snapshots older than this, e.g. 720h. The newest one is always kept. (0 keeps all)")
+var moveOrphans = flag.Bool("backup.move-orphans", false, "Move the backup folders of repositories that are no longer listed by their job to .deleted in the job's folder, instead of removing them like -backup.prune-orphans.")
+var orphanGrace = flag.Duration("backup.orphan-grace", 0, "Only prune or move orphaned backup folders once they have been orphaned this long, e.g. 720h, in case their repository comes back. (0 acts right away)")
+var pruneOrphans = flag.Bool("backup.prune-orphans", false, "Remove the backup folders of repositories that are no longer listed by their job, e.g. because they were renamed or deleted upstream. With -backup.archive they are archived first. (without it they are only reported)")
+var snapshot = flag.Bool("backup.snapshot", false, "Back up each run into a new folder named with the time of the run, <source>/<repo>/<timestamp>, keeping earlier runs as point-in-time snapshots.")
+var verify = flag.Bool("backup.verify", false, "Check the integrity of each repository with git fsck after backing it up (requires git).")
+var s3Endpoint = flag.String("s3.endpoint", "https://s3.amazonaws.com", "The S3 compatible endpoint to upload backups to, e.g. http://minio.local:9000.")
+var s3Bucket = flag.String("s3.bucket", "", "Upload each backed up repository, or its archive, to this bucket. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.")
+var s3Prefix = flag.String("s3.prefix", "", "The prefix of the uploaded object names.")
+var s3Concurrency = flag.Int("s3.concurrency", 4, "How many parts of a large file to upload at the same time.")
+var s3PartSize = flag.String("s3.part-size", "64MB", "Upload files larger than this in parts of this size, at least 5MB. An upload that was cut off is resumed from its last part by the next run.")
+var s3AbortAfter = flag.Duration("s3.abort-incomplete-after", 7*24*time.Hour, "Abort multipart uploads that were started longer ago than this and never completed, so their parts are no longer stored. (0 keeps them)")
+var fetchLFS = flag.Bool("backup.lfs", false, "Also fetch the Git LFS objects of repositories that use LFS (requires git and git-lfs). Jobs can override this with lfs.")
+var force = flag.Bool("backup.force", false, "Fetch every repository, also those whose refs have not changed since the last run.")
+var skipArchived = flag.Bool("backup.skip-archived", false, "Skip archived repositories. Jobs can override this with skip_archived.")
+var skipForks = flag.Bool("backup.skip-forks", false, "Skip forked repositories. Jobs can override this with skip_forks.")
+var reposFromStdin = flag.Bool("repos-from-stdin", false, "Only back up the repositories listed on stdin, one full name or url per line.")
+var recordFile = flag.String("record.file", "", "Record the repositories listed by each source to this file, without credentials.")
+var replayFile = flag.String("replay.file", "", "Replay the repositories recorded with -record.file instead of listing the configured sources.")
+var sourceIP = flag.String("network.source-ip", "", "Bind outgoing https clones, fetches and API calls to this local IP address. ssh connections are not bound.")
+var connectTimeout = flag.Duration("network.connect-timeout", 10*time.Second, "How long to wait for an https or API connection to a host to be established. ssh connections are not affected.")
 var printVersion = flag.Bool("version", false, "Show the version number and exit.")
-var enableInsecure = flag.Bool("insecure", false, "Use this flag to disable verification of SSL/TLS certificates")
+var quiet = flag.Bool("quiet", false, "Discard the clone and fetch progress. Without it the progress is logged at debug level.")
+var enableInsecure = flag.Bool("insecure", false, "Use this flag to disable verification of SSL/TLS certificates and SSH host keys")
+var backupSettings = flag.Bool("backup.settings", false, "Also back up repository settings such as branch protection rules and webhooks as JSON.")
+var commitGraph = flag.Bool("backup.commit-graph", false, "Write commit-graph and bitmap files after fetching to speed up later fetches (requires git).")
+var includeEmpty = flag.Bool("backup.include-empty", false, "Leave a marker file in the backup folder of repositories that are empty.")
+var verifyWorktree = flag.Bool("backup.verify-worktree", false, "Check that the working tree of non-bare clones matches HEAD and reset it when it has drifted.")
+var importFrom = flag.String("backup.import-from", "", "Copy existing clones from this folder instead of cloning repositories from scratch. Clones are found by owner/name, or by name when their origin points at the repository, and are left in place.")
+var restoreDoc = flag.Bool("backup.restore-doc", false, "Write a RESTORE.md per job describing how to restore each repository from its backup folder or archive. Repositories that failed or were left out of a run are listed with their previous backup.")
+var maxRefs = flag.Int("backup.max-refs", 0, "Log a warning for repositories with more refs than this. (0 disables the check)")
+var maxRefsDefaultBranch = flag.Bool("backup.max-refs-default-branch", false, "Only back up the default branch of repositories with more refs than -backup.max-refs.")
+var maxFailures = flag.Int("backup.max-consecutive-failures", 0, "Disable repositories that failed this many runs in a row: they are skipped until -backup.reset-failures, with a warning on the run that disabled them, and listed as disabled in the manifest and reports. (0 disables skipping)")
+var resetFailures = flag.Bool("backup.reset-failures", false, "Forget previous failures, so skipped repositories are tried again.")
+var minSizeRatio = flag.Float64("backup.min-size-ratio", 0, "Fail repositories whose backup is smaller than this fraction of the size reported by the provider, e.g. 0.1. Shallow and single branch clones are not checked, nor are GitLab projects the token cannot read the statistics of. (0 disables the check)")
+var maxRetries = flag.Int("backup.max-retries", gitbackup.DefaultRetryPolicy.MaxRetries, "How many times to retry a repository after a transient error such as a connection reset. Jobs can override this with max_retries, and the delay before the first retry with retry_base_delay.")
+var repoTimeout = flag.Duration("backup.repo-timeout", 0, "Give up on a repository that takes longer than this to back up, e.g. 30m. Jobs can override this with repo_timeout. (0 means no timeout)")
+var atomicBackup = flag.Bool("backup.atomic", false, "Back up each repository into a temporary directory and only replace the previous backup when it succeeds.")
+var preflight = flag.Bool("backup.preflight", false, "Check that every source host is reachable before starting the backup.")
+var preflightTimeout = flag.Duration("backup.preflight-timeout", 10*time.Second, "How long to wait for a source host to respond during the preflight check.")
+var monitorPingURL = flag.String("monitor.ping-url", "", "A healthchecks.io style ping url: <url>/start is pinged when the backup starts, <url> when it succeeds and <url>/fail when it fails. The -monitor.*-url flags take precedence.")
+var monitorStartURL = flag.String("monitor.start-url", "", "Send a ping to this url when the backup starts.")
+var monitorSuccessURL = flag.String("monitor.success-url", "", "Send a ping to this url when the backup finishes without errors.")
+var monitorFailURL = flag.String("monitor.fail-url", "", "Send a ping to this url when the backup fails.")
+var notifyWebhookURL = flag.String("notify.webhook-url", "", "POST the result of the backup as JSON to this url.")
+var notifySlackURL = flag.String("notify.slack-url", "", "Post the result of the backup to this Slack (or Discord /slack) webhook url.")
+var notifySlackMaxFailures = flag.Int("notify.slack-max-failures", 10, "List at most this many failed repositories in the Slack message, after the count of failures per category. The log lists all of them. (0 lists all)")
+var notifySMTPHost = flag.String("notify.smtp-host", "", "Mail the result of the backup through this SMTP server, see -notify.email-to.")
+var notifySMTPPort = flag.Int("notify.smtp-port", 587, "The port of the SMTP server.")
+var notifySMTPTLS = flag.String("notify.smtp-tls", "starttls", "How to secure the SMTP connection: starttls, tls (usually on port 465) or none.")
+var notifySMTPUsername = flag.String("notify.smtp-username", "", "The SMTP username. No authentication is used when empty.")
+var notifySMTPPassword = flag.String("notify.smtp-password", "", "The SMTP password.")
+var notifyEmailFrom = flag.String("notify.email-from", "", "The sender address of the result email.")
+var notifyEmailTo = flag.String("notify.email-to", "", "A comma separated list of addresses to mail the result of the backup to.")
+
+// notifiers are sent the result of the backup once it is done, see the notify
+// flags, as routed by the notify_routes of the config.
+var notifiers []gitbackup.NamedNotifier
+var notifyRoutes []*gitbackup.NotifyRoute
+
+var metricsPushgateway = flag.String("metrics.pushgateway", "", "Push metrics of the backup, with histograms of how long each repository took to clone and each source to list, to this Prometheus Pushgateway url at the end of a run, replacing those of the previous run. The time of the last successful run is pushed to its own group, labeled result=\"success\".")
+var reportFile = flag.String("report.file", "", "Write the result of the backup, with the outcome of every repository, as JSON to this file.")
+var reportJUnit = flag.String("report.junit", "", "Write the result of the backup as a JUnit XML report to this file, with a test case per repository.")
+var rateLimit = flag.String("backup.rate-limit", "", "Limit the throughput of https clones, fetches and API calls to this much per second, shared by all connections (e.g. 10MB). ssh is not limited. (0 means unlimited)")
+var maxTotalSize = flag.String("backup.max-total-size", "", "Stop starting new repositories once the backed up repositories take up this much space (e.g. 50GB). The repositories left out are listed as deferred in the log and the manifest.")
+
+var logLevel = flag.String("log.level", "info", "Only log messages of at least this level: debug, info, warn or error.")
+var logFormat = flag.String("log.format", "text", "The log format: text or json.")
 
 var Version = "dev"
 var CommitHash = "n/a"
@@ -25,11 +110,17 @@ var BuildTimestamp = "n/a"
 
 func main() {
 	flag.Parse()
-	log.Printf("inscure: %v", *enableInsecure)
+	handler, err := newLogHandler(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.Debug("Parsed flags", "insecure", *enableInsecure)
 
 	if *printVersion {
-		log.Printf("git-backup, version %s (%s-%s)", Version, runtime.GOOS, runtime.GOARCH)
-		log.Printf("Built %s (%s)", CommitHash, BuildTimestamp)
+		slog.Info("git-backup", "version", Version, "os", runtime.GOOS, "arch", runtime.GOARCH)
+		slog.Info("Built", "commit", CommitHash, "timestamp", BuildTimestamp)
 		os.Exit(0)
 	}
 
@@ -37,61 +128,1038 @@ func main() {
 		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
+	dialer := &net.Dialer{
+		Timeout:   *connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if *sourceIP != "" {
+		ip := net.ParseIP(*sourceIP)
+		if ip == nil {
+			slog.Error("Invalid source ip", "ip", *sourceIP)
+			os.Exit(1)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	dial := gitbackup.DialFunc(dialer.DialContext)
+	if *rateLimit != "" {
+		bytesPerSecond, err := gitbackup.ParseSize(*rateLimit)
+		if err != nil {
+			slog.Error("Invalid -backup.rate-limit", "error", err)
+			os.Exit(1)
+		}
+		if bytesPerSecond > 0 {
+			dial = gitbackup.RateLimitedDial(dial, gitbackup.NewRateLimiter(bytesPerSecond))
+		}
+	}
+	http.DefaultTransport.(*http.Transport).DialContext = dial
+	http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout = *connectTimeout
+
+	if flag.Arg(0) == "restore" {
+		os.Exit(runRestore(flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(flag.Args()[1:]))
+	}
+
+	sizeBudget, err := gitbackup.ParseSize(*maxTotalSize)
+	if err != nil {
+		slog.Error("Invalid -backup.max-total-size", "error", err)
+		os.Exit(1)
+	}
+
+	archive, err := gitbackup.ParseArchiveFormat(*archiveFormat)
+	if err != nil {
+		slog.Error("Invalid -backup.archive", "error", err)
+		os.Exit(1)
+	}
+	if err := archive.CheckLevel(*archiveLevel); err != nil {
+		slog.Error("Invalid -backup.archive-level", "error", err)
+		os.Exit(1)
+	}
+	if *archiveLevel == 0 {
+		*archiveLevel = archive.DefaultLevel()
+	}
+
+	retention := gitbackup.RetentionPolicy{
+		Count:  *retentionCount,
+		MaxAge: *retentionAge,
+		DryRun: *dryRun,
+	}
+	if retention.Enabled() && archive == gitbackup.ArchiveNone && !*snapshot {
+		slog.Warn("-backup.retention-count and -backup.retention-age only apply to archives and snapshots, set -backup.archive or -backup.snapshot")
+	}
+
+	var uploader gitbackup.Uploader
+	if *s3Bucket != "" {
+		partSize, err := gitbackup.ParseSize(*s3PartSize)
+		if err != nil {
+			slog.Error("Invalid -s3.part-size", "error", err)
+			os.Exit(1)
+		}
+		s3Uploader, err := gitbackup.NewS3Uploader(*s3Endpoint, *s3Bucket, *s3Prefix, *s3Concurrency, partSize)
+		if err == nil {
+			err = s3Uploader.Test(context.Background())
+		}
+		if err != nil {
+			slog.Error("Failed to connect to s3", "endpoint", *s3Endpoint, "bucket", *s3Bucket, "error", err)
+			os.Exit(1)
+		}
+		if *s3AbortAfter > 0 && !*dryRun {
+			aborted, err := s3Uploader.AbortIncompleteUploads(context.Background(), *s3AbortAfter)
+			for _, object := range aborted {
+				slog.Info("Aborted abandoned upload", "object", object)
+			}
+			if err != nil {
+				slog.Warn("Failed to abort abandoned uploads", "error", err)
+			}
+		}
+		uploader = s3Uploader
+	}
+
+	var wantedRepos map[string]bool
+	if *reposFromStdin {
+		wantedRepos = readWantedRepos(os.Stdin)
+	}
+
+	if *monitorPingURL != "" {
+		pingURL := strings.TrimSuffix(*monitorPingURL, "/")
+		if *monitorStartURL == "" {
+			*monitorStartURL = pingURL + "/start"
+		}
+		if *monitorSuccessURL == "" {
+			*monitorSuccessURL = pingURL
+		}
+		if *monitorFailURL == "" {
+			*monitorFailURL = pingURL + "/fail"
+		}
+	}
+	if *notifyWebhookURL != "" {
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "webhook", Notifier: &gitbackup.WebhookNotifier{URL: *notifyWebhookURL}})
+	}
+	if *notifySlackURL != "" {
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "slack", Notifier: &gitbackup.SlackNotifier{WebhookURL: *notifySlackURL, MaxFailures: *notifySlackMaxFailures}})
+	}
+	if *notifySMTPHost != "" {
+		if *notifyEmailFrom == "" || *notifyEmailTo == "" {
+			slog.Error("-notify.smtp-host requires -notify.email-from and -notify.email-to")
+			os.Exit(1)
+		}
+		if *notifySMTPTLS != "starttls" && *notifySMTPTLS != "tls" && *notifySMTPTLS != "none" {
+			slog.Error("Invalid -notify.smtp-tls, expected starttls, tls or none", "tls", *notifySMTPTLS)
+			os.Exit(1)
+		}
+		var to []string
+		for _, address := range strings.Split(*notifyEmailTo, ",") {
+			to = append(to, strings.TrimSpace(address))
+		}
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "email", Notifier: &gitbackup.EmailNotifier{
+			Host:     *notifySMTPHost,
+			Port:     *notifySMTPPort,
+			TLS:      *notifySMTPTLS,
+			Username: *notifySMTPUsername,
+			Password: *notifySMTPPassword,
+			From:     *notifyEmailFrom,
+			To:       to,
+		}})
+	}
+	if *metricsPushgateway != "" {
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "pushgateway", Notifier: &gitbackup.PushgatewayNotifier{URL: *metricsPushgateway}})
+	}
+	if *reportFile != "" {
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "report", Notifier: &gitbackup.JSONReport{Path: *reportFile}})
+	}
+	if *reportJUnit != "" {
+		notifiers = append(notifiers, gitbackup.NamedNotifier{Name: "junit", Notifier: &gitbackup.JUnitReport{Path: *reportJUnit}})
+	}
+
 	config := loadConfig()
+	notifyRoutes = config.NotifyRoutes
+	for _, route := range notifyRoutes {
+		for _, name := range route.Notifiers {
+			if !slices.ContainsFunc(notifiers, func(notifier gitbackup.NamedNotifier) bool { return notifier.Name == name }) {
+				slog.Warn("notify_routes refers to a notifier that is not configured", "notifier", name, "outcome", route.Outcome)
+			}
+		}
+	}
+	ping(*monitorStartURL, "")
 	sources := config.GetSources()
+	if *replayFile != "" {
+		recording, err := gitbackup.LoadRecording(*replayFile)
+		if err != nil {
+			slog.Error("Failed to load recording", "error", err)
+			exit(1)
+		}
+		sources = recording.GetSources()
+	}
 	if len(sources) == 0 {
-		log.Printf("Found a config file at [%s] but detected no sources. Are you sure the file is properly formed?", *configFilePath)
-		os.Exit(111)
+		slog.Error("Found a config file but detected no sources. Are you sure the file is properly formed?", "file", *configFilePath)
+		exit(111)
 	}
+	if *preflight {
+		for _, source := range sources {
+			if err := gitbackup.CheckReachable(source.GetURL(), *preflightTimeout); err != nil {
+				slog.Error("Preflight failed", "source", source.GetName(), "error", err)
+				exit(110)
+			}
+		}
+		slog.Info("Preflight passed, all sources are reachable", "sources", len(sources))
+	}
+	cloneOptions := gitbackup.CloneOptions{
+		Bare:                *bareClone,
+		MaxRefs:             *maxRefs,
+		DefaultBranchOnly:   *maxRefsDefaultBranch,
+		Retry:               gitbackup.DefaultRetryPolicy,
+		InsecureSkipHostKey: *enableInsecure,
+		Prune:               *prune,
+		LFS:                 *fetchLFS,
+		Depth:               *depth,
+	}
+	if *depth < 0 {
+		slog.Error("-backup.depth must not be negative")
+		exit(1)
+	}
+	cloneOptions.Retry.MaxRetries = *maxRetries
+	cloneOptions.Timeout = *repoTimeout
+	if config.CloneOptions != nil {
+		if err := config.CloneOptions.Apply(&cloneOptions); err != nil {
+			slog.Error("Invalid clone_options", "error", err)
+			exit(1)
+		}
+	}
+	if config.Mirror != nil && *archiveRemove {
+		slog.Error("The mirror section cannot be combined with -backup.archive-remove, which removes the backup before it is pushed")
+		exit(1)
+	}
+	if config.Mirror != nil {
+		// the mirror rejects a push from a shallow clone, its history is incomplete,
+		// and would only get the one branch of a single branch clone
+		for _, source := range sources {
+			sourceOptions := cloneOptions
+			if optionsSource, ok := source.(gitbackup.OptionsSource); ok {
+				// invalid job options are reported when the job runs
+				_ = optionsSource.GetOptions().Apply(&sourceOptions)
+			}
+			if sourceOptions.Depth > 0 {
+				slog.Error("The mirror section cannot be combined with a shallow clone, set by -backup.depth, clone_options or the job's depth", "source", source.GetName(), "depth", sourceOptions.Depth)
+				exit(1)
+			}
+			if sourceOptions.SingleBranch {
+				slog.Error("The mirror section cannot be combined with clone_options.single_branch", "source", source.GetName())
+				exit(1)
+			}
+		}
+	}
+	if *pruneOrphans && *moveOrphans {
+		slog.Error("-backup.prune-orphans and -backup.move-orphans cannot be combined")
+		exit(1)
+	}
+	if *prune && !*bareClone {
+		slog.Warn("-backup.prune only applies to bare clones, working tree clones are not pruned")
+	}
+	statePath := filepath.Join(*targetPath, gitbackup.StateFileName)
+	state, err := gitbackup.LoadState(statePath)
+	if err != nil {
+		slog.Error("Failed to load state", "error", err)
+		exit(1)
+	}
+	if *resetFailures {
+		for _, repoState := range state.Repositories {
+			repoState.ConsecutiveFailures = 0
+		}
+	}
+	recording := &gitbackup.Recording{}
+	pause := newPauser()
+	watchPauseSignals(pause)
+	interrupt := watchInterruptSignals(pause)
 	repoCount := 0
+	changedCount := 0
+	skippedCount := 0
+	emptyCount := 0
+	adoptedCount := 0
+	disabledCount := 0
+	clonedCount := 0
 	errors := 0
+	failures := make([]gitbackup.Failure, 0)
+	statuses := make([]gitbackup.RepositoryStatus, 0)
+	manifest := gitbackup.Manifest{Repositories: make([]*gitbackup.ManifestEntry, 0)}
+	// read before this run replaces it, for the size trend in the notifications
+	var previousSize *int64
+	if previous, err := gitbackup.ReadManifest(filepath.Join(*targetPath, gitbackup.ManifestFileName)); err == nil {
+		size := previous.TotalSize()
+		previousSize = &size
+	}
+	ignored := 0
+	deferred := make([]string, 0)
+	notStarted := 0
+	orphanCount := 0
+	var totalSize int64
+	sourceSizes := make(map[string]int64)
+	cloneDurations := make([]time.Duration, 0)
+	listDurations := make(map[string]time.Duration)
+	listedRepos := make(map[string][]*gitbackup.Repository)
 	backupStart := time.Now()
+	manifest.Started = backupStart
+	layout := gitbackup.BackupLayout(gitbackup.FlatLayout)
+	if *snapshot {
+		layout = gitbackup.SnapshotLayout(backupStart)
+	}
 	for _, source := range sources {
+		if interrupt.stopped() {
+			break
+		}
 		sourceName := source.GetName()
-		log.Printf("=== %s ===", sourceName)
+		slog.Info("Backing up source", "source", sourceName)
 		if err := source.Test(); err != nil {
-			log.Printf("Failed to verify connection to job [%s]: %s", sourceName, err)
-			os.Exit(110)
+			slog.Error("Failed to verify connection", "source", sourceName, "error", err)
+			exit(110)
 		}
+		listStart := time.Now()
 		repos, err := source.ListRepositories()
+		listDurations[sourceName] += time.Since(listStart)
 		if err != nil {
-			log.Printf("Communication Error: %s", err)
-			os.Exit(100)
+			slog.Error("Failed to list repositories", "source", sourceName, "error", err)
+			exit(100)
+		}
+		sourcePath := filepath.Join(*targetPath, sourceName)
+		// jobs can share a folder, their orphans are only known once all of them are listed
+		listedRepos[sourcePath] = append(listedRepos[sourcePath], repos...)
+		if *recordFile != "" {
+			recording.Add(source, repos)
+			if err := recording.Save(*recordFile); err != nil {
+				slog.Warn("Failed to save recording", "error", err)
+			}
+		}
+		sourceSkipArchived, sourceSkipForks := *skipArchived, *skipForks
+		if skipSource, ok := source.(gitbackup.SkipSource); ok {
+			archived, forks := skipSource.GetSkip()
+			if archived != nil {
+				sourceSkipArchived = *archived
+			}
+			if forks != nil {
+				sourceSkipForks = *forks
+			}
+		}
+		repos, archivedCount, forkCount := gitbackup.SkipRepositories(repos, sourceSkipArchived, sourceSkipForks)
+		if archivedCount > 0 || forkCount > 0 {
+			slog.Info("Skipped archived and forked repositories", "source", sourceName, "archived", archivedCount, "forks", forkCount)
+		}
+		if filterSource, ok := source.(gitbackup.FilterSource); ok {
+			include, exclude := filterSource.GetFilter()
+			listed := len(repos)
+			if repos, err = gitbackup.FilterRepositories(repos, include, exclude); err != nil {
+				slog.Error("Invalid include/exclude pattern", "source", sourceName, "error", err)
+				exit(1)
+			}
+			if filtered := listed - len(repos); filtered > 0 {
+				slog.Info("Filtered out repositories by include/exclude patterns", "source", sourceName, "filtered", filtered, "listed", listed)
+			}
+		}
+		if wantedRepos != nil {
+			repos = selectWantedRepos(repos, wantedRepos)
+		}
+		canary, abortOnCanary := "", false
+		if canarySource, ok := source.(gitbackup.CanarySource); ok {
+			canary, abortOnCanary = canarySource.GetCanary()
+		}
+		if canary != "" {
+			var found bool
+			if repos, found = canaryFirst(repos, canary); !found {
+				slog.Warn("Canary repository was not found", "source", sourceName, "repo", canary)
+			}
+		}
+		sourceOptions := cloneOptions
+		if optionsSource, ok := source.(gitbackup.OptionsSource); ok {
+			if err := optionsSource.GetOptions().Apply(&sourceOptions); err != nil {
+				slog.Error("Invalid job options", "source", sourceName, "error", err)
+				exit(1)
+			}
 		}
 		for _, repo := range repos {
-			log.Printf("Discovered %s", repo.FullName)
-			targetPath := filepath.Join(*targetPath, sourceName, repo.FullName)
+			pause.wait()
+			if interrupt.stopped() {
+				notStarted++
+				repo.ClearCredentials()
+				continue
+			}
+			slog.Info("Discovered repository", "source", sourceName, "repo", repo.FullName)
+			if sizeBudget > 0 && totalSize >= sizeBudget {
+				slog.Info("Deferring repository, the backup size budget has been reached", "repo", repo.FullName, "budget", gitbackup.FormatSize(sizeBudget))
+				deferred = append(deferred, repo.FullName)
+				manifest.Repositories = append(manifest.Repositories, &gitbackup.ManifestEntry{
+					FullName: repo.FullName,
+					Source:   sourceName,
+					Path:     layout(sourcePath, repo),
+					Deferred: true,
+				})
+				writeManifest(manifest)
+				statuses = append(statuses, gitbackup.RepositoryStatus{
+					Repository: repo.FullName,
+					Source:     sourceName,
+					Outcome:    gitbackup.OutcomeDeferred,
+				})
+				repo.ClearCredentials()
+				continue
+			}
+			targetPath := layout(sourcePath, repo)
+			repoState := state.Repository(filepath.ToSlash(filepath.Join(sourceName, repo.FullName)))
+			if *maxFailures > 0 && repoState.ConsecutiveFailures >= *maxFailures {
+				// the warning was logged when it was disabled
+				slog.Debug("Skipping disabled repository", "repo", repo.FullName, "consecutive_failures", repoState.ConsecutiveFailures)
+				disabledCount++
+				manifest.Repositories = append(manifest.Repositories, &gitbackup.ManifestEntry{
+					FullName: repo.FullName,
+					Source:   sourceName,
+					Path:     targetPath,
+					Disabled: true,
+				})
+				writeManifest(manifest)
+				statuses = append(statuses, gitbackup.RepositoryStatus{
+					Repository: repo.FullName,
+					Source:     sourceName,
+					Outcome:    gitbackup.OutcomeDisabled,
+				})
+				repo.ClearCredentials()
+				continue
+			}
+			if err := config.RewriteURL(repo); err != nil {
+				slog.Error("Failed to rewrite clone url", "source", sourceName, "repo", repo.FullName, "error", err)
+				exit(100)
+			}
+			if *dryRun {
+				slog.Info("Would back up repository", "source", sourceName, "repo", repo.FullName, "path", targetPath)
+				repoCount++
+				continue
+			}
 			err := os.MkdirAll(targetPath, os.ModePerm)
 			if err != nil {
-				log.Printf("Failed to create directory: %s", err)
-				os.Exit(100)
+				slog.Error("Failed to create directory", "path", targetPath, "error", err)
+				exit(100)
 			}
-			err = repo.CloneInto(targetPath, *bareClone)
-			if err != nil {
+			repoErrors, repoFailures := errors, len(failures)
+			if *snapshot && isEmptyDir(targetPath) {
+				// start from the previous snapshot, so only what changed since is fetched
+				if previous, err := gitbackup.SeedSnapshot(targetPath); err != nil {
+					errors++
+					failure := gitbackup.NewFailure(repo.FullName, err)
+					failures = append(failures, failure)
+					slog.Error("Failed to copy the previous snapshot", "source", sourceName, "repo", repo.FullName, "path", targetPath, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+					discardSnapshot(targetPath)
+					statuses = append(statuses, gitbackup.RepositoryStatus{Repository: repo.FullName, Source: sourceName, Outcome: gitbackup.OutcomeFailed, Failure: &failure})
+					repo.ClearCredentials()
+					continue
+				} else if previous != "" {
+					slog.Debug("Seeded snapshot from the previous one", "repo", repo.FullName, "path", previous)
+				}
+			}
+			if *importFrom != "" && isEmptyDir(targetPath) {
+				if existing := gitbackup.FindExistingClone(*importFrom, repo); existing == "" {
+					slog.Info("No existing clone found, cloning from scratch", "repo", repo.FullName)
+					clonedCount++
+				} else if err := repo.Adopt(existing, targetPath); err != nil {
+					errors++
+					failure := gitbackup.NewFailure(repo.FullName, err)
+					failures = append(failures, failure)
+					slog.Error("Failed to adopt existing clone", "source", sourceName, "repo", repo.FullName, "path", existing, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+					// don't clone from scratch what was meant to be adopted
+					statuses = append(statuses, gitbackup.RepositoryStatus{Repository: repo.FullName, Source: sourceName, Outcome: gitbackup.OutcomeFailed, Failure: &failure})
+					repo.ClearCredentials()
+					continue
+				} else {
+					slog.Info("Adopted existing clone", "repo", repo.FullName, "path", existing)
+					adoptedCount++
+				}
+			}
+			// remove the marker so an empty folder is left for the clone
+			_ = os.Remove(filepath.Join(targetPath, emptyMarker))
+			repoStart := time.Now()
+			repoOptions := sourceOptions
+			repoOptions.Progress = newProgressWriter(repo.FullName)
+			ctx, cancel := interrupt.ctx, context.CancelFunc(func() {})
+			if repoOptions.Timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, repoOptions.Timeout)
+			}
+			// a cheap listing of the remote refs tells whether there is anything to fetch at all
+			fingerprint, fingerprintErr := repo.RemoteFingerprint(ctx, repoOptions)
+			if !*force && fingerprintErr == nil && fingerprint == repoState.RemoteFingerprint && !isEmptyDir(targetPath) {
+				cancel()
+				skippedCount++
+				slog.Info("Skipping repository, its refs have not changed since the last run", "source", sourceName, "repo", repo.FullName)
+				size, _ := gitbackup.DirSize(targetPath)
+				totalSize += size
+				sourceSizes[sourceName] += size
+				entry := &gitbackup.ManifestEntry{
+					FullName: repo.FullName,
+					Source:   sourceName,
+					Path:     targetPath,
+					Size:     size,
+					Success:  true,
+				}
+				entry.Inspect(targetPath)
+				manifest.Repositories = append(manifest.Repositories, entry)
+				writeManifest(manifest)
+				statuses = append(statuses, gitbackup.RepositoryStatus{
+					Repository: repo.FullName,
+					Source:     sourceName,
+					Outcome:    gitbackup.OutcomeSkipped,
+					Size:       size,
+					Duration:   time.Since(repoStart),
+				})
+				repo.ClearCredentials()
+				continue
+			}
+			var changed bool
+			cloneStart := time.Now()
+			if *atomicBackup {
+				changed, err = repo.CloneIntoAtomic(ctx, targetPath, repoOptions)
+			} else {
+				changed, err = repo.CloneInto(ctx, targetPath, repoOptions)
+			}
+			cloneDurations = append(cloneDurations, time.Since(cloneStart))
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %s: %w", repoOptions.Timeout, err)
+			}
+			cancel()
+			if changed {
+				changedCount++
+			}
+			if err == nil && *minSizeRatio > 0 {
+				err = checkSize(targetPath, repo, repoOptions, *minSizeRatio)
+			}
+			if err != nil && !config.IsIgnoredError(err) {
+				repoState.ConsecutiveFailures++
+				if *maxFailures > 0 && repoState.ConsecutiveFailures == *maxFailures {
+					slog.Warn("Disabling repository after it failed too many runs in a row, use -backup.reset-failures to try it again", "source", sourceName, "repo", repo.FullName, "consecutive_failures", repoState.ConsecutiveFailures)
+				}
+			} else {
+				repoState.ConsecutiveFailures = 0
+			}
+			if err := state.Save(statePath); err != nil {
+				slog.Warn("Failed to save state", "error", err)
+			}
+			if err != nil && config.IsIgnoredError(err) {
+				ignored++
+				slog.Info("Ignoring expected error", "source", sourceName, "repo", repo.FullName, "error", err)
+			} else if err != nil {
 				errors++
-				log.Printf("Failed to clone: %s", err)
+				failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+				slog.Error("Failed to clone", "source", sourceName, "repo", repo.FullName, "duration", time.Since(repoStart), "error", err)
 				if *failAtEnd == false {
-					os.Exit(100)
+					exit(100)
+				}
+				if abortOnCanary && repo.Matches(canary) {
+					slog.Error("Canary repository failed, aborting", "source", sourceName, "repo", repo.FullName)
+					exit(100)
+				}
+			}
+			// decided before the marker is written, which makes the folder non-empty
+			empty := isEmptyDir(targetPath)
+			if err == nil && empty {
+				emptyCount++
+				if *includeEmpty {
+					if err := writeEmptyMarker(targetPath, repo); err != nil {
+						slog.Warn("Failed to write empty repository marker", "repo", repo.FullName, "error", err)
+					}
+				}
+			}
+			if err == nil && *verifyWorktree && !repoOptions.Bare && !empty {
+				if drifted, err := gitbackup.VerifyWorktree(targetPath); err != nil {
+					errors++
+					failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+					slog.Error("Failed to verify worktree", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				} else if drifted {
+					slog.Warn("The worktree had drifted from HEAD and was reset", "repo", repo.FullName)
+				}
+			}
+			if err == nil && *commitGraph && !empty {
+				if err := gitbackup.WriteCommitGraph(targetPath); err != nil {
+					errors++
+					failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+					slog.Error("Failed to write commit-graph", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				}
+			}
+			if err == nil && *verify && !empty {
+				if err := gitbackup.VerifyRepository(targetPath); err != nil {
+					errors++
+					failures = append(failures, gitbackup.Failure{Repository: repo.FullName, Category: gitbackup.FailureVerification, Error: err.Error()})
+					slog.Error("Failed to verify", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				}
+			}
+			if *snapshot && (err != nil || errors > repoErrors) {
+				discardSnapshot(targetPath)
+			}
+			sizePath, uploadPath := targetPath, targetPath
+			archived := false
+			// never archive a repository that failed in any way, so a partial backup is not shipped
+			if err == nil && errors == repoErrors && archive != gitbackup.ArchiveNone && !empty {
+				archivePath := targetPath + archive.Extension()
+				if retention.Enabled() && !*snapshot {
+					archivePath = gitbackup.TimestampedArchivePath(targetPath, archive, backupStart)
+				}
+				if err := gitbackup.ArchiveRepository(targetPath, archivePath, archive, *archiveLevel); err != nil {
+					errors++
+					failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+					slog.Error("Failed to archive", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				} else {
+					uploadPath, archived = archivePath, true
+					if *archiveRemove {
+						if err := os.RemoveAll(targetPath); err != nil {
+							slog.Warn("Failed to remove archived backup folder", "path", targetPath, "error", err)
+						}
+						sizePath = archivePath
+					}
+				}
+			}
+			if err == nil && errors == repoErrors && uploader != nil && !empty {
+				key, _ := filepath.Rel(sourcePath, uploadPath)
+				if err := uploader.Upload(context.Background(), uploadPath, path.Join(sourceName, filepath.ToSlash(key))); err != nil {
+					errors++
+					failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+					slog.Error("Failed to upload", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				}
+			}
+			// a failed mirror push is labeled as such, the backup itself is fine
+			if err == nil && errors == repoErrors && config.Mirror != nil && !empty {
+				if err := mirrorRepository(config.Mirror, targetPath, repo, repoOptions); err != nil {
+					errors++
+					failures = append(failures, gitbackup.Failure{Repository: repo.FullName, Category: gitbackup.FailureMirror, Error: err.Error()})
+					slog.Error("Failed to push to the mirror", "source", sourceName, "repo", repo.FullName, "error", err)
+					if *failAtEnd == false {
+						exit(100)
+					}
+				}
+			}
+			if *backupSettings {
+				if settingsSource, ok := source.(gitbackup.SettingsSource); ok {
+					metaPath := filepath.Join(sourcePath, ".meta", repo.FullName)
+					if err := writeSettings(settingsSource, repo, metaPath); err != nil {
+						errors++
+						failures = append(failures, gitbackup.NewFailure(repo.FullName, err))
+						slog.Error("Failed to back up settings", "source", sourceName, "repo", repo.FullName, "error", err)
+						if *failAtEnd == false {
+							exit(100)
+						}
+					}
 				}
 			}
 			repoCount++
+			size, sizeErr := gitbackup.DirSize(sizePath)
+			if sizeErr != nil && !os.IsNotExist(sizeErr) {
+				slog.Warn("Failed to determine size", "path", sizePath, "error", sizeErr)
+			}
+			totalSize += size
+			sourceSizes[sourceName] += size
+			entry := &gitbackup.ManifestEntry{
+				FullName: repo.FullName,
+				Source:   sourceName,
+				Path:     sizePath,
+				Size:     size,
+				Success:  err == nil && errors == repoErrors,
+			}
+			entry.Inspect(targetPath)
+			// the backup folder may be gone by now, archived with -backup.archive-remove
+			entry.Empty = err == nil && empty
+			if archived {
+				entry.Archive, entry.ArchiveLevel = string(archive), *archiveLevel
+			}
+			if err != nil {
+				entry.Error = err.Error()
+			} else if len(failures) > repoFailures {
+				entry.Error = failures[len(failures)-1].Error
+			}
+			manifest.Repositories = append(manifest.Repositories, entry)
+			writeManifest(manifest)
+			status := gitbackup.RepositoryStatus{
+				Repository: repo.FullName,
+				Source:     sourceName,
+				Outcome:    gitbackup.OutcomeUnchanged,
+				Size:       size,
+				Duration:   time.Since(repoStart),
+			}
+			if changed {
+				status.Outcome = gitbackup.OutcomeChanged
+			}
+			if !entry.Success {
+				status.Outcome = gitbackup.OutcomeFailed
+				if len(failures) > repoFailures {
+					failure := failures[len(failures)-1]
+					status.Failure = &failure
+				} else if err != nil {
+					failure := gitbackup.NewFailure(repo.FullName, err)
+					status.Failure = &failure
+				}
+			}
+			statuses = append(statuses, status)
+			// only remember the refs when everything succeeded, so failed steps are retried next run
+			if entry.Success && fingerprintErr == nil {
+				repoState.RemoteFingerprint = fingerprint
+			} else {
+				repoState.RemoteFingerprint = ""
+			}
+			if err := state.Save(statePath); err != nil {
+				slog.Warn("Failed to save state", "error", err)
+			}
+			repo.ClearCredentials()
+		}
+		if *restoreDoc && !*dryRun {
+			// also the repositories that failed or were left out this run, their previous backup is still there
+			if err := gitbackup.WriteRestoreDoc(sourcePath, sourceName, listedRepos[sourcePath], layout); err != nil {
+				slog.Warn("Failed to write restore documentation", "source", sourceName, "error", err)
+			}
+		}
+		// the source is done, don't keep its credentials around for the rest of the run
+		if holder, ok := source.(gitbackup.CredentialHolder); ok {
+			holder.ClearCredentials()
 		}
 	}
-	log.Printf("Backed up %d repositories in %s, encountered %d errors", repoCount, time.Now().Sub(backupStart), errors)
+	for wanted, found := range wantedRepos {
+		if !found && !interrupt.stopped() {
+			errors++
+			failures = append(failures, gitbackup.Failure{Repository: wanted, Category: gitbackup.FailureNotFound, Error: "not found in any of the configured sources"})
+			slog.Error("Could not find repository in any of the configured sources", "repo", wanted)
+		}
+	}
+	if !interrupt.stopped() {
+		sourcePaths := make([]string, 0, len(listedRepos))
+		for sourcePath := range listedRepos {
+			sourcePaths = append(sourcePaths, sourcePath)
+		}
+		sort.Strings(sourcePaths)
+		for _, sourcePath := range sourcePaths {
+			found, err := reconcileOrphans(sourcePath, listedRepos[sourcePath], archive, state)
+			if err != nil {
+				errors++
+				slog.Error("Failed to remove orphaned backup folder", "error", err)
+			}
+			orphanCount += found
+		}
+		if !*dryRun {
+			if err := state.Save(statePath); err != nil {
+				slog.Warn("Failed to save state", "error", err)
+			}
+		}
+	}
+	// only rotate out old archives after a fully successful run, so the last good copy is never removed
+	if errors == 0 && !interrupt.stopped() && retention.Enabled() {
+		pruned, err := gitbackup.PruneBackups(*targetPath, retention)
+		for _, path := range pruned {
+			slog.Info("Removed backup outside the retention policy", "path", path, "dry_run", *dryRun)
+		}
+		if err != nil {
+			errors++
+			slog.Error("Failed to apply the retention policy", "error", err)
+		}
+	}
+	finished := time.Now()
+	manifest.Finished = &finished
+	writeManifest(manifest)
+	duration := time.Now().Sub(backupStart)
+	summary := fmt.Sprintf("Backed up %d repositories (%d changed, %d skipped) in %s, encountered %d errors", repoCount, changedCount, skippedCount, duration, errors)
+	if interrupt.stopped() {
+		summary = fmt.Sprintf("Backup interrupted: backed up %d repositories (%d changed, %d skipped) in %s, %d not started, encountered %d errors", repoCount, changedCount, skippedCount, duration, notStarted, errors)
+	}
+	if *dryRun {
+		summary = fmt.Sprintf("Dry run: would back up %d repositories, encountered %d errors", repoCount, errors)
+	}
+	if orphanCount > 0 {
+		summary += fmt.Sprintf(", found %d orphaned backup folders", orphanCount)
+	}
+	slog.Info(summary, "repositories", repoCount, "changed", changedCount, "skipped", skippedCount, "duration", duration, "errors", errors)
+	slog.Info("Total size on disk", "size", gitbackup.FormatSize(totalSize))
+	if *importFrom != "" {
+		slog.Info("Imported existing clones", "adopted", adoptedCount, "cloned", clonedCount)
+	}
+	if disabledCount > 0 {
+		slog.Info("Skipped disabled repositories, use -backup.reset-failures to try them again", "disabled", disabledCount)
+	}
+	if emptyCount > 0 {
+		slog.Info("Found empty repositories", "empty", emptyCount)
+	}
+	if len(failures) > 0 {
+		slog.Error("Failed repositories", "failed", len(failures))
+		fmt.Fprint(os.Stderr, gitbackup.FailureTable(failures))
+	}
+	if ignored > 0 {
+		slog.Info("Ignored expected errors", "ignored", ignored)
+	}
+	if len(deferred) > 0 {
+		slog.Warn("Deferred repositories after reaching the backup size budget", "deferred", len(deferred), "used", gitbackup.FormatSize(totalSize), "repos", strings.Join(deferred, ", "))
+	}
 
+	notify(gitbackup.BackupResult{
+		Repositories:   repoCount,
+		Changed:        changedCount,
+		Skipped:        skippedCount,
+		TotalBytes:     totalSize,
+		SourceBytes:    sourceSizes,
+		PreviousBytes:  previousSize,
+		Errors:         errors,
+		Failures:       failures,
+		Duration:       duration,
+		CloneDurations: cloneDurations,
+		ListDurations:  listDurations,
+		Interrupted:    interrupt.stopped(),
+		Summary:        summary,
+		Statuses:       statuses,
+	})
+	if interrupt.stopped() {
+		ping(*monitorFailURL, summary)
+		os.Exit(130)
+	}
 	if errors > 0 {
+		ping(*monitorFailURL, summary)
 		os.Exit(100)
 	}
+	ping(*monitorSuccessURL, summary)
+}
+
+// exit stops the backup with the given exit code, notifying the fail monitor first.
+func exit(code int) {
+	summary := fmt.Sprintf("git-backup exited with code %d", code)
+	notify(gitbackup.BackupResult{Errors: 1, Summary: summary})
+	ping(*monitorFailURL, summary)
+	os.Exit(code)
+}
+
+// notify does nothing in a dry run, which must not report a backup that
+// never happened, unless -backup.dry-run-notify asks to test the notifiers.
+func notify(result gitbackup.BackupResult) {
+	if *dryRun && !*dryRunNotify {
+		return
+	}
+	routed := gitbackup.RouteNotifiers(notifiers, notifyRoutes, result.RunOutcome())
+	if err := gitbackup.NotifyAll(routed, result); err != nil {
+		slog.Warn("Failed to send notification", "error", err)
+	}
+}
+
+// ping does nothing in a dry run, which must not reset the monitor's schedule.
+func ping(url string, body string) {
+	if url == "" || *dryRun {
+		return
+	}
+	if err := gitbackup.Ping(url, body); err != nil {
+		slog.Warn("Failed to ping monitor", "error", err)
+	}
+}
+
+// writeManifest writes the manifest of the run so far, so a crash still leaves
+// a record of the repositories that were done. Nothing is written in a dry run.
+func writeManifest(manifest gitbackup.Manifest) {
+	if *dryRun {
+		return
+	}
+	if err := gitbackup.WriteManifest(filepath.Join(*targetPath, gitbackup.ManifestFileName), manifest); err != nil {
+		slog.Warn("Failed to write manifest", "error", err)
+	}
+}
+
+// checkSize guards against a failed fetch reported as success, by comparing
+// the size on disk to the size reported by the provider. Clones limited to
+// part of the history or refs are expected to be smaller, and not checked.
+func checkSize(path string, repo *gitbackup.Repository, opts gitbackup.CloneOptions, minRatio float64) error {
+	if repo.Size == 0 {
+		return nil
+	}
+	if opts.Depth > 0 || opts.SingleBranch || (opts.DefaultBranchOnly && opts.MaxRefs > 0) {
+		slog.Debug("Not checking the size of a partial clone", "repo", repo.FullName)
+		return nil
+	}
+	size, err := gitbackup.DirSize(path)
+	if err != nil {
+		return err
+	}
+	if float64(size) < minRatio*float64(repo.Size) {
+		return fmt.Errorf("backup of %s is suspiciously small: %s on disk, but the provider reports %s", repo.FullName, gitbackup.FormatSize(size), gitbackup.FormatSize(repo.Size))
+	}
+	return nil
+}
+
+// canaryFirst moves the canary repository to the front, so it is backed up first.
+func canaryFirst(repos []*gitbackup.Repository, canary string) ([]*gitbackup.Repository, bool) {
+	for i, repo := range repos {
+		if repo.Matches(canary) {
+			ordered := append([]*gitbackup.Repository{repo}, repos[:i]...)
+			return append(ordered, repos[i+1:]...), true
+		}
+	}
+	return repos, false
+}
+
+// readWantedRepos reads one repository name or url per line, skipping blank lines.
+func readWantedRepos(reader io.Reader) map[string]bool {
+	wanted := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			wanted[line] = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Error("Failed to read repositories from stdin", "error", err)
+		os.Exit(1)
+	}
+	return wanted
+}
+
+// selectWantedRepos keeps only the repos that were asked for and marks them as found.
+func selectWantedRepos(repos []*gitbackup.Repository, wanted map[string]bool) []*gitbackup.Repository {
+	selected := make([]*gitbackup.Repository, 0)
+	for _, repo := range repos {
+		for nameOrURL := range wanted {
+			if repo.Matches(nameOrURL) {
+				wanted[nameOrURL] = true
+				selected = append(selected, repo)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// emptyMarker is the file left behind in the backup folder of empty repositories.
+const emptyMarker = "EMPTY_REPOSITORY.txt"
+
+// reconcileOrphans reports the backup folders in sourcePath that belong to
+// none of the listed repositories, and removes them with -backup.prune-orphans
+// or moves them with -backup.move-orphans, once they have been orphaned for
+// -backup.orphan-grace. It returns the number of orphaned folders it found.
+// Only sources that listed their repositories get here, a source that failed
+// to list exits the run before.
+func reconcileOrphans(sourcePath string, listed []*gitbackup.Repository, archive gitbackup.ArchiveFormat, state *gitbackup.State) (int, error) {
+	orphans, err := gitbackup.FindOrphans(sourcePath, listed)
+	if err != nil {
+		return 0, err
+	}
+	// an empty listing more likely means lost access than that everything was deleted
+	if len(orphans) > 0 && len(listed) == 0 {
+		slog.Warn("Not looking for orphaned backup folders, no repositories were listed", "path", sourcePath)
+		return 0, nil
+	}
+	// forget the folders that were orphaned before, but are not anymore
+	current := make(map[string]bool, len(orphans))
+	for _, orphan := range orphans {
+		current[filepath.ToSlash(orphan)] = true
+	}
+	for key := range state.Orphans {
+		if strings.HasPrefix(key, filepath.ToSlash(sourcePath)+"/") && !current[key] && !*dryRun {
+			delete(state.Orphans, key)
+		}
+	}
+
+	now := time.Now()
+	for _, orphan := range orphans {
+		key := filepath.ToSlash(orphan)
+		since, ok := state.Orphans[key]
+		if !ok {
+			since = now
+			if !*dryRun {
+				state.Orphans[key] = since
+			}
+		}
+		if !(*pruneOrphans || *moveOrphans) || *dryRun || now.Sub(since) < *orphanGrace {
+			slog.Warn("Found orphaned backup folder, its repository was renamed or deleted upstream", "path", orphan, "orphaned_since", since.Format(time.RFC3339), "prune", *pruneOrphans, "move", *moveOrphans, "dry_run", *dryRun)
+			continue
+		}
+		if *moveOrphans {
+			moved, err := gitbackup.MoveOrphan(sourcePath, orphan)
+			if err != nil {
+				return len(orphans), err
+			}
+			delete(state.Orphans, key)
+			slog.Info("Moved orphaned backup folder, its repository was renamed or deleted upstream", "path", orphan, "to", moved)
+			continue
+		}
+		if archive != gitbackup.ArchiveNone {
+			if err := gitbackup.ArchiveRepository(orphan, orphan+archive.Extension(), archive, *archiveLevel); err != nil {
+				return len(orphans), fmt.Errorf("archive %s: %w", orphan, err)
+			}
+		}
+		if err := os.RemoveAll(orphan); err != nil {
+			return len(orphans), err
+		}
+		delete(state.Orphans, key)
+		slog.Info("Removed orphaned backup folder, its repository was renamed or deleted upstream", "path", orphan, "archived", archive != gitbackup.ArchiveNone)
+	}
+	return len(orphans), nil
+}
+
+func mirrorRepository(mirror *gitbackup.MirrorConfig, path string, repo *gitbackup.Repository, opts gitbackup.CloneOptions) error {
+	target, err := mirror.Target(repo.FullName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	return gitbackup.MirrorRepository(ctx, path, target, opts, mirror.Verify)
+}
+
+func isEmptyDir(path string) bool {
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
+
+// discardSnapshot removes the snapshot folder of a failed backup. Left in
+// place, the next run would seed from it and the retention policy would count
+// it, possibly pruning the last good snapshot in its favour.
+func discardSnapshot(path string) {
+	if err := os.RemoveAll(path); err != nil {
+		slog.Warn("Failed to remove the snapshot of a failed backup", "path", path, "error", err)
+	}
+}
+
+func writeEmptyMarker(path string, repo *gitbackup.Repository) error {
+	message := fmt.Sprintf("%s was empty when it was backed up at %s.\n", repo.FullName, time.Now().Format(time.RFC3339))
+	return os.WriteFile(filepath.Join(path, emptyMarker), []byte(message), 0644)
+}
+
+func writeSettings(source gitbackup.SettingsSource, repo *gitbackup.Repository, metaPath string) error {
+	settings, err := source.GetSettings(repo)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(metaPath, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(metaPath, "settings.json"), data, 0644)
 }
 
 func loadConfig() gitbackup.Config {
 	// try config file in working directory
-	config, err := gitbackup.LoadFile(*configFilePath)
+	config, err := gitbackup.LoadFile(*configFilePath, !*configNoExpand)
 	if os.IsNotExist(err) {
-		log.Println("No config file found. Exiting...")
+		slog.Error("No config file found. Exiting...", "file", *configFilePath)
 		os.Exit(1)
 	} else if err != nil {
-		log.Printf("Error: %s", err)
+		slog.Error("Failed to load config", "file", *configFilePath, "error", err)
 		os.Exit(1)
 	}
 	return config
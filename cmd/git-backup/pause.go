@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// pauser lets an operator pause the backup between repositories.
+type pauser struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+func newPauser() *pauser {
+	p := &pauser{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pauser) setPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return
+	}
+	p.paused = paused
+	if paused {
+		slog.Info("Pausing, no new repositories will be started until resumed")
+	} else {
+		slog.Info("Resuming")
+		p.cond.Broadcast()
+	}
+}
+
+// wait blocks for as long as the backup is paused.
+func (p *pauser) wait() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.paused {
+		p.cond.Wait()
+	}
+}
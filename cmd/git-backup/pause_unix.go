@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals pauses the backup on SIGUSR1 and resumes it on SIGUSR2.
+func watchPauseSignals(p *pauser) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			p.setPaused(sig == syscall.SIGUSR1)
+		}
+	}()
+}
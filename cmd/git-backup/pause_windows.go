@@ -0,0 +1,4 @@
+package main
+
+// watchPauseSignals is a no-op, windows has no SIGUSR1 and SIGUSR2.
+func watchPauseSignals(_ *pauser) {}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	gitbackup "git-backup"
+	"log/slog"
+)
+
+// runRestore implements `git-backup restore`, which pushes a backed up
+// repository to a new remote, and returns the exit code.
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := flags.String("from", "", "The backup folder of the repository to restore, e.g. backup/GitHub/my-org/my-repo.")
+	to := flags.String("to", "", "The url of the new, empty repository to push the backup to, with credentials for https urls.")
+	sshKey := flags.String("ssh-key", "", "The private key to push over ssh with. When no key is set the ssh agent is used.")
+	sshKeyPassphrase := flags.String("ssh-key-passphrase", "", "The passphrase of the ssh key.")
+	sshKnownHosts := flags.String("ssh-known-hosts", "", "The known_hosts file to verify host keys with. -insecure skips the verification.")
+	_ = flags.Parse(args)
+	if *from == "" || *to == "" {
+		slog.Error("restore requires -from and -to")
+		flags.Usage()
+		return 1
+	}
+
+	key := &gitbackup.SSHKey{Path: *sshKey, Passphrase: *sshKeyPassphrase, KnownHosts: *sshKnownHosts}
+	opts := gitbackup.CloneOptions{InsecureSkipHostKey: *enableInsecure, Progress: newProgressWriter(*from)}
+	restored, err := gitbackup.RestoreRepository(context.Background(), *from, *to, key, opts)
+	if err != nil {
+		slog.Error("Failed to restore", "from", *from, "error", err)
+		return 100
+	}
+	for _, ref := range restored {
+		if ref.UpToDate {
+			slog.Info("Ref is up-to-date", "ref", ref.Name, "commit", ref.Hash)
+		} else {
+			slog.Info("Pushed ref", "ref", ref.Name, "commit", ref.Hash)
+		}
+	}
+	slog.Info("Restored backup", "from", *from, "refs", len(restored))
+	return 0
+}
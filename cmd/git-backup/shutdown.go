@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interrupter stops the backup between repositories on SIGINT or SIGTERM,
+// so the run still ends with a summary and notifications. The repository
+// being backed up is finished first, a second signal cancels it through ctx.
+// After that the signals are no longer caught, so a third one terminates the
+// process right away if cancelling hangs.
+type interrupter struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	interrupted atomic.Bool
+}
+
+func watchInterruptSignals(p *pauser) *interrupter {
+	i := &interrupter{}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		slog.Warn("Interrupted, finishing the current repository, signal again to cancel it", "signal", sig)
+		i.interrupted.Store(true)
+		// a paused backup would never get to notice the interruption
+		p.setPaused(false)
+		sig = <-signals
+		slog.Warn("Interrupted again, cancelling the current repository, signal again to exit right away", "signal", sig)
+		signal.Stop(signals)
+		i.cancel()
+	}()
+	return i
+}
+
+// stopped reports whether no new repositories should be started.
+func (i *interrupter) stopped() bool {
+	return i.interrupted.Load()
+}
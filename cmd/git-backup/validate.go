@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	gitbackup "git-backup"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+// runValidate implements `git-backup validate`, which checks the config and
+// the credentials of every source without cloning anything, and returns the
+// exit code.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	offline := flags.Bool("offline", false, "Only check the config file, without verifying the credentials with the providers.")
+	_ = flags.Parse(args)
+
+	config := loadConfig()
+	sources := config.GetSources()
+	if len(sources) == 0 {
+		slog.Error("The config file has no sources", "file", *configFilePath)
+		return 111
+	}
+
+	report := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	names := make(map[string]bool)
+	failed := 0
+	for _, source := range sources {
+		err := validateSource(source, names, *offline)
+		if err != nil {
+			failed++
+			_, _ = fmt.Fprintf(report, "FAIL\t%s\t%s\n", source.GetName(), err)
+		} else {
+			_, _ = fmt.Fprintf(report, "PASS\t%s\t%s\n", source.GetName(), source.GetURL())
+		}
+	}
+	_ = report.Flush()
+
+	if failed > 0 {
+		slog.Error("Config is invalid", "file", *configFilePath, "sources", len(sources), "failed", failed)
+		return 1
+	}
+	slog.Info("Config is valid", "file", *configFilePath, "sources", len(sources))
+	return 0
+}
+
+func validateSource(source gitbackup.RepositorySource, names map[string]bool, offline bool) error {
+	// the job name is the backup folder, so two jobs with the same name would overwrite each other
+	if names[source.GetName()] {
+		return fmt.Errorf("job_name %q is used by another job", source.GetName())
+	}
+	names[source.GetName()] = true
+	if validatingSource, ok := source.(gitbackup.ValidatingSource); ok {
+		if err := validatingSource.Validate(); err != nil {
+			return err
+		}
+	}
+	if offline {
+		return nil
+	}
+	return source.Test()
+}
@@ -1,18 +1,40 @@
 package git_backup
 
 import (
+	"bytes"
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"io"
 	"os"
+	"regexp"
+	"strings"
 )
 
 type Config struct {
-	Github []*GithubConfig `yaml:"github"`
-	GitLab []*GitLabConfig `yaml:"gitlab"`
+	Github       []*GithubConfig `yaml:"github"`
+	GitLab       []*GitLabConfig `yaml:"gitlab"`
+	Gitea        []*GiteaConfig  `yaml:"gitea"`
+	IgnoreErrors []string        `yaml:"ignore_errors,omitempty"`
+	RewriteURLs  []*URLRewrite   `yaml:"rewrite_urls,omitempty"`
+	CloneOptions *GitOptions     `yaml:"clone_options,omitempty"`
+	Mirror       *MirrorConfig   `yaml:"mirror,omitempty"`
+	NotifyRoutes []*NotifyRoute  `yaml:"notify_routes,omitempty"`
+	ignoreErrors []*regexp.Regexp
+}
+
+// IsIgnoredError reports whether err matches one of the configured
+// ignore_errors patterns and should therefore not count as a failure.
+func (c *Config) IsIgnoredError(err error) bool {
+	for _, pattern := range c.ignoreErrors {
+		if pattern.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Config) GetSources() []RepositorySource {
-	sources := make([]RepositorySource, len(c.Github)+len(c.GitLab))
+	sources := make([]RepositorySource, len(c.Github)+len(c.GitLab)+len(c.Gitea))
 
 	offset := 0
 	for i := 0; i < len(c.Github); i++ {
@@ -23,6 +45,10 @@ func (c *Config) GetSources() []RepositorySource {
 		sources[offset] = c.GitLab[i]
 		offset++
 	}
+	for i := 0; i < len(c.Gitea); i++ {
+		sources[offset] = c.Gitea[i]
+		offset++
+	}
 
 	return sources
 }
@@ -38,24 +64,150 @@ func (c *Config) setDefaults() {
 			config.setDefaults()
 		}
 	}
+	if c.Gitea != nil {
+		for _, config := range c.Gitea {
+			config.setDefaults()
+		}
+	}
 }
 
-func LoadFile(path string) (out Config, err error) {
+// LoadFile loads the config file at path, see LoadReader.
+func LoadFile(path string, expandEnv bool) (out Config, err error) {
 	handle, err := os.Open(path)
 	if err != nil {
 		return
 	}
 	defer func() {
-		err = handle.Close()
+		if closeErr := handle.Close(); err == nil {
+			err = closeErr
+		}
 	}()
-	out, err = LoadReader(handle)
+	out, err = LoadReader(handle, expandEnv)
 	return
 }
 
-func LoadReader(reader io.Reader) (out Config, err error) {
+// LoadReader loads a config file from reader. With expandEnv, $VAR and
+// ${VAR} in values are replaced by environment variables, so secrets can
+// stay out of the file, and $$ is a literal $.
+func LoadReader(reader io.Reader, expandEnv bool) (out Config, err error) {
+	if expandEnv {
+		if reader, err = expandEnvReader(reader); err != nil {
+			return
+		}
+	}
 	dec := yaml.NewDecoder(reader)
 	dec.KnownFields(true)
 	err = dec.Decode(&out)
+	if err != nil {
+		return
+	}
+	if err = out.compile(); err != nil {
+		return
+	}
 	out.setDefaults()
 	return
 }
+
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandEnvReader expands the environment variables in the values of the
+// YAML document in reader. Only names such as $NAME and ${NAME} are
+// expanded, so $1 in a url rewrite and $ in a regular expression are kept.
+func expandEnvReader(reader io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	// re-encoding moves things around, which would make the line numbers in errors harder to follow
+	if !bytes.Contains(data, []byte("$")) {
+		return bytes.NewReader(data), nil
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if err := expandEnvNode(&document, ""); err != nil {
+		return nil, err
+	}
+	data, err = yaml.Marshal(&document)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func expandEnvNode(node *yaml.Node, key string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := expandEnvNode(child, key); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childKey := node.Content[i].Value
+			if key != "" {
+				childKey = key + "." + childKey
+			}
+			if err := expandEnvNode(node.Content[i+1], childKey); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := expandEnvNode(child, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		var undefined string
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			if reference == "$$" {
+				return "$"
+			}
+			name := strings.Trim(reference, "${}")
+			value, ok := os.LookupEnv(name)
+			if !ok && undefined == "" {
+				undefined = name
+			}
+			return value
+		})
+		if undefined != "" {
+			return fmt.Errorf("%s refers to the undefined environment variable %s", key, undefined)
+		}
+		// let the expanded value decide its type, so e.g. depth: ${DEPTH} is a number
+		node.Tag = ""
+	}
+	return nil
+}
+
+// compile parses the patterns in the config so mistakes surface when loading it.
+func (c *Config) compile() error {
+	for _, pattern := range c.IgnoreErrors {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid ignore_errors pattern %q: %w", pattern, err)
+		}
+		c.ignoreErrors = append(c.ignoreErrors, compiled)
+	}
+	for _, rewrite := range c.RewriteURLs {
+		if err := rewrite.compile(); err != nil {
+			return err
+		}
+	}
+	if c.Mirror != nil {
+		if err := c.Mirror.compile(); err != nil {
+			return err
+		}
+	}
+	for _, route := range c.NotifyRoutes {
+		if err := route.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package git_backup
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailNotifier mails the result of a backup run over SMTP, as a plain text
+// and HTML message.
+type EmailNotifier struct {
+	Host string
+	Port int
+	// TLS is starttls (the default), tls for implicit TLS, usually on port
+	// 465, or none.
+	TLS string
+	// Username and Password are used for PLAIN authentication when set.
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// emailTimeout limits the whole SMTP conversation, not just the dial, so a
+// stalled server cannot hang the end of the run.
+var emailTimeout = pingClient.Timeout
+
+func (n *EmailNotifier) Notify(result BackupResult) error {
+	message, err := createEmailMessage(n.From, n.To, result, time.Now())
+	if err != nil {
+		return err
+	}
+	return n.send(message)
+}
+
+func (n *EmailNotifier) send(message []byte) error {
+	address := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	tlsConfig := &tls.Config{ServerName: n.Host}
+
+	var conn net.Conn
+	var err error
+	switch n.TLS {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	case "", "starttls", "none":
+		conn, err = dialer.Dial("tcp", address)
+	default:
+		return fmt.Errorf("unknown smtp tls mode %q, expected starttls, tls or none", n.TLS)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.TLS == "" || n.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<html><body>
+<p><strong>{{.Subject}}</strong></p>
+<p>{{.Summary}}</p>
+<p>Total size: {{.TotalSize}}</p>
+{{- if .Sources}}
+<ul>{{range .Sources}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+{{- if .Failures}}
+<p>Failed repositories:</p>
+<pre>{{.Failures}}</pre>
+{{- end}}
+</body></html>
+`))
+
+// createEmailMessage renders result as a multipart/alternative message with
+// a plain text and an HTML part, including the headers.
+func createEmailMessage(from string, to []string, result BackupResult, date time.Time) ([]byte, error) {
+	subject := "git-backup succeeded"
+	if result.Interrupted {
+		subject = "git-backup was interrupted"
+	} else if !result.Success() {
+		subject = "git-backup failed"
+	}
+	sources := sourceSizeLines(result)
+
+	var text strings.Builder
+	text.WriteString(result.Summary)
+	fmt.Fprintf(&text, "\nTotal size: %s\n", result.TotalSize())
+	for _, source := range sources {
+		fmt.Fprintf(&text, "%s\n", source)
+	}
+	if len(result.Failures) > 0 {
+		fmt.Fprintf(&text, "\nFailed repositories:\n%s", FailureTable(result.Failures))
+	}
+
+	var html bytes.Buffer
+	err := emailTemplate.Execute(&html, map[string]any{
+		"Subject":   subject,
+		"Summary":   result.Summary,
+		"TotalSize": result.TotalSize(),
+		"Sources":   sources,
+		"Failures":  FailureTable(result.Failures),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
@@ -0,0 +1,156 @@
+package git_backup
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateEmailMessageSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  BackupResult
+		subject string
+	}{
+		{name: "success", result: BackupResult{Summary: "Backed up 2 repositories"}, subject: "git-backup succeeded"},
+		{name: "errors", result: BackupResult{Errors: 1}, subject: "git-backup failed"},
+		{name: "interrupted", result: BackupResult{Interrupted: true}, subject: "git-backup was interrupted"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := parseEmail(t, test.result)
+			if subject := message.Header.Get("Subject"); subject != test.subject {
+				t.Errorf("Subject = %q, want %q", subject, test.subject)
+			}
+		})
+	}
+}
+
+func TestCreateEmailMessage(t *testing.T) {
+	date := time.Date(2026, 1, 15, 2, 0, 0, 0, time.UTC)
+	result := BackupResult{
+		Repositories: 3,
+		Errors:       1,
+		Failures:     []Failure{{Repository: "my-org/<script>", Category: FailureAuth, Error: "authentication required"}},
+		TotalBytes:   2048,
+		SourceBytes:  map[string]int64{"GitHub": 2048},
+		Summary:      "Backed up 3 repositories, encountered 1 errors",
+	}
+	raw, err := createEmailMessage("backup@example.com", []string{"a@example.com", "b@example.com"}, result, date)
+	if err != nil {
+		t.Fatalf("createEmailMessage() error = %v", err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("the message cannot be parsed: %v", err)
+	}
+	for header, want := range map[string]string{
+		"From":         "backup@example.com",
+		"To":           "a@example.com, b@example.com",
+		"Date":         date.Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+	} {
+		if got := message.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	parts := readEmailParts(t, message)
+	text, html := parts["text/plain"], parts["text/html"]
+	for _, want := range []string{result.Summary, "Total size: 2.0 KB", "GitHub", "auth (1)", "my-org/<script>", "authentication required"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{result.Summary, "<pre>", "my-org/&lt;script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html part does not contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("html part does not escape the repository name:\n%s", html)
+	}
+}
+
+func parseEmail(t *testing.T, result BackupResult) *mail.Message {
+	t.Helper()
+	raw, err := createEmailMessage("backup@example.com", []string{"ops@example.com"}, result, time.Now())
+	if err != nil {
+		t.Fatalf("createEmailMessage() error = %v", err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("the message cannot be parsed: %v", err)
+	}
+	return message
+}
+
+// readEmailParts returns the decoded parts of a multipart/alternative
+// message by media type.
+func readEmailParts(t *testing.T, message *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", message.Header.Get("Content-Type"))
+	}
+	parts := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		// the reader decodes the quoted-printable content
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[partType] = string(content)
+	}
+}
+
+func TestEmailNotifierStalledServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// accept connections but never send the SMTP greeting
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	timeout := emailTimeout
+	emailTimeout = 200 * time.Millisecond
+	defer func() {
+		emailTimeout = timeout
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	notifier := &EmailNotifier{Host: "127.0.0.1", Port: address.Port, TLS: "none", From: "backup@example.com", To: []string{"ops@example.com"}}
+	start := time.Now()
+	if err := notifier.Notify(BackupResult{Summary: "Backed up 1 repositories"}); err == nil {
+		t.Error("Notify() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify() returned after %s, want it to give up after the timeout", elapsed)
+	}
+}
@@ -0,0 +1,145 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// FailureCategory groups the failures of a run by their cause.
+type FailureCategory string
+
+const (
+	FailureAuth         FailureCategory = "auth"
+	FailureNetwork      FailureCategory = "network"
+	FailureDisk         FailureCategory = "disk"
+	FailureTimeout      FailureCategory = "timeout"
+	FailureNotFound     FailureCategory = "not found"
+	FailureVerification FailureCategory = "verification"
+	FailureMirror       FailureCategory = "mirror"
+	FailureLFSQuota     FailureCategory = "lfs quota"
+	FailureOther        FailureCategory = "other"
+)
+
+// Failure is a repository that failed, and why.
+type Failure struct {
+	Repository string          `json:"repository"`
+	Category   FailureCategory `json:"category"`
+	Error      string          `json:"error"`
+}
+
+// NewFailure records that repository failed with err, in the category
+// ClassifyError picks for it.
+func NewFailure(repository string, err error) Failure {
+	return Failure{Repository: repository, Category: ClassifyError(err), Error: err.Error()}
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s (%s: %s)", f.Repository, f.Category, f.Error)
+}
+
+// authMessages catch authentication errors that go-git and the ssh package
+// report without wrapping.
+var authMessages = []string{
+	"unable to authenticate",
+	"permission denied (publickey",
+	"authentication required",
+	"authorization failed",
+}
+
+// ClassifyError picks the category of err. Verification and mirror
+// failures cannot be told apart by their error, so the caller sets those.
+func ClassifyError(err error) FailureCategory {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		return FailureTimeout
+	case errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return FailureAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return FailureNotFound
+	case errors.Is(err, ErrLFSQuota):
+		return FailureLFSQuota
+	case errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) || errors.Is(err, syscall.EROFS) ||
+		errors.Is(err, fs.ErrPermission):
+		return FailureDisk
+	}
+	message := strings.ToLower(err.Error())
+	// go-git does not always wrap the context's error
+	if strings.Contains(message, "context deadline exceeded") {
+		return FailureTimeout
+	}
+	for _, auth := range authMessages {
+		if strings.Contains(message, auth) {
+			return FailureAuth
+		}
+	}
+	// what is left of the local file errors, such as a missing or unreadable
+	// folder. Checked first, *fs.PathError also satisfies net.Error.
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return FailureDisk
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || DefaultRetryPolicy.IsTransient(err) {
+		return FailureNetwork
+	}
+	return FailureOther
+}
+
+// FailureTable renders failures as a plain text table, grouped by category
+// with a count per category and sorted by repository.
+func FailureTable(failures []Failure) string {
+	return FailureSample(failures, 0)
+}
+
+// FailureSample renders failures like FailureTable, with the count of every
+// category but only the first limit repositories, followed by how many were
+// left out. This keeps a message readable when hundreds of repositories
+// fail at once. A limit of 0 lists every repository.
+func FailureSample(failures []Failure, limit int) string {
+	byCategory := make(map[FailureCategory][]Failure)
+	for _, failure := range failures {
+		byCategory[failure.Category] = append(byCategory[failure.Category], failure)
+	}
+	categories := make([]string, 0, len(byCategory))
+	for category := range byCategory {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	listed := 0
+	for _, category := range categories {
+		group := byCategory[FailureCategory(category)]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Repository < group[j].Repository
+		})
+		_, _ = fmt.Fprintf(writer, "%s (%d)\n", category, len(group))
+		for _, failure := range group {
+			if limit > 0 && listed >= limit {
+				break
+			}
+			listed++
+			// the table is one line per repository, multi-line errors such as git's output would break it up
+			message := strings.Join(strings.Fields(failure.Error), " ")
+			_, _ = fmt.Fprintf(writer, "  %s\t%s\n", failure.Repository, message)
+		}
+	}
+	if omitted := len(failures) - listed; omitted > 0 {
+		_, _ = fmt.Fprintf(writer, "... and %d more\n", omitted)
+	}
+	_ = writer.Flush()
+	return table.String()
+}
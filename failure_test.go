@@ -0,0 +1,109 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want FailureCategory
+	}{
+		{name: "no error", err: nil, want: ""},
+		{name: "deadline", err: fmt.Errorf("timed out after 30m: %w", context.DeadlineExceeded), want: FailureTimeout},
+		{name: "canceled", err: context.Canceled, want: FailureTimeout},
+		{name: "unwrapped deadline", err: errors.New("read tcp: context deadline exceeded"), want: FailureTimeout},
+		{name: "authentication required", err: transport.ErrAuthenticationRequired, want: FailureAuth},
+		{name: "authorization failed", err: fmt.Errorf("fetch: %w", transport.ErrAuthorizationFailed), want: FailureAuth},
+		{name: "invalid auth method", err: transport.ErrInvalidAuthMethod, want: FailureAuth},
+		{name: "ssh publickey", err: errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey]"), want: FailureAuth},
+		{name: "git permission denied", err: errors.New("git@example.com: Permission denied (publickey)."), want: FailureAuth},
+		{name: "not found", err: transport.ErrRepositoryNotFound, want: FailureNotFound},
+		{name: "disk full", err: &fs.PathError{Op: "write", Path: "/backup/pack", Err: syscall.ENOSPC}, want: FailureDisk},
+		{name: "read-only file system", err: fmt.Errorf("clone: %w", syscall.EROFS), want: FailureDisk},
+		{name: "permission", err: &fs.PathError{Op: "open", Path: "/backup", Err: fs.ErrPermission}, want: FailureDisk},
+		{name: "missing folder", err: &fs.PathError{Op: "open", Path: "/backup", Err: syscall.ENOENT}, want: FailureDisk},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, want: FailureNetwork},
+		{name: "connection reset", err: fmt.Errorf("fetch: %w", syscall.ECONNRESET), want: FailureNetwork},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: FailureNetwork},
+		{name: "unwrapped reset", err: errors.New("read: connection reset by peer"), want: FailureNetwork},
+		{name: "lfs quota", err: fmt.Errorf("%w: batch response: This repository is over its data quota", ErrLFSQuota), want: FailureLFSQuota},
+		{name: "anything else", err: errors.New("object not found"), want: FailureOther},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ClassifyError(test.err); got != test.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFailureTable(t *testing.T) {
+	failures := []Failure{
+		NewFailure("my-org/b", transport.ErrAuthenticationRequired),
+		{Repository: "my-org/c", Category: FailureVerification, Error: "git fsck failed:\nerror: broken link"},
+		NewFailure("my-org/a", transport.ErrAuthorizationFailed),
+	}
+	table := FailureTable(failures)
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	want := []string{"auth (2)", "  my-org/a", "  my-org/b", "verification (1)", "  my-org/c"}
+	if len(lines) != len(want) {
+		t.Fatalf("FailureTable() has %d lines, want %d:\n%s", len(lines), len(want), table)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want it to start with %q", i+1, lines[i], prefix)
+		}
+	}
+	if !strings.Contains(lines[4], "git fsck failed: error: broken link") {
+		t.Errorf("multi-line errors should be joined into one line, got %q", lines[4])
+	}
+	if FailureTable(nil) != "" {
+		t.Errorf("FailureTable(nil) = %q, want an empty table", FailureTable(nil))
+	}
+}
+
+func TestFailureSample(t *testing.T) {
+	failures := []Failure{
+		{Repository: "my-org/d", Category: FailureNetwork, Error: "connection reset"},
+		{Repository: "my-org/b", Category: FailureAuth, Error: "authentication required"},
+		{Repository: "my-org/c", Category: FailureNetwork, Error: "connection reset"},
+		{Repository: "my-org/a", Category: FailureAuth, Error: "authentication required"},
+	}
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 0, want: []string{"auth (2)", "  my-org/a", "  my-org/b", "network (2)", "  my-org/c", "  my-org/d"}},
+		{limit: 4, want: []string{"auth (2)", "  my-org/a", "  my-org/b", "network (2)", "  my-org/c", "  my-org/d"}},
+		// every category keeps its count, even when none of its repositories are listed
+		{limit: 1, want: []string{"auth (2)", "  my-org/a", "network (2)", "... and 3 more"}},
+		{limit: 3, want: []string{"auth (2)", "  my-org/a", "  my-org/b", "network (2)", "  my-org/c", "... and 1 more"}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.limit), func(t *testing.T) {
+			sample := FailureSample(failures, test.limit)
+			lines := strings.Split(strings.TrimSuffix(sample, "\n"), "\n")
+			if len(lines) != len(test.want) {
+				t.Fatalf("FailureSample() has %d lines, want %d:\n%s", len(lines), len(test.want), sample)
+			}
+			for i, prefix := range test.want {
+				if !strings.HasPrefix(lines[i], prefix) {
+					t.Errorf("line %d = %q, want it to start with %q", i+1, lines[i], prefix)
+				}
+			}
+		})
+	}
+}
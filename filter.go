@@ -0,0 +1,77 @@
+package git_backup
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// FilterRepositories returns the repositories whose full name matches any
+// of the include glob patterns (or all of them when include is empty) and
+// none of the exclude patterns. Patterns use path.Match syntax and are
+// matched case-insensitively, so "my-org/*" selects every repository
+// directly in my-org. An exclude entry without a slash also excludes every
+// repository of that owner. Exclude wins when both match.
+func FilterRepositories(repos []*Repository, include, exclude []string) ([]*Repository, error) {
+	if err := validatePatterns(include, exclude); err != nil {
+		return nil, err
+	}
+	out := make([]*Repository, 0, len(repos))
+	for _, repo := range repos {
+		if len(include) > 0 && !matchesAny(include, repo.FullName) {
+			continue
+		}
+		if matchesAny(exclude, repo.FullName) || isExcluded(exclude, repo.FullName) {
+			continue
+		}
+		out = append(out, repo)
+	}
+	return out, nil
+}
+
+func validatePatterns(include, exclude []string) error {
+	for _, pattern := range slices.Concat(include, exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipRepositories leaves out archived repositories and forks, as selected,
+// and returns how many of each were left out.
+func SkipRepositories(repos []*Repository, archived, forks bool) ([]*Repository, int, int) {
+	out := make([]*Repository, 0, len(repos))
+	archivedCount, forkCount := 0, 0
+	for _, repo := range repos {
+		switch {
+		case archived && repo.Archived:
+			archivedCount++
+		case forks && repo.Fork:
+			forkCount++
+		default:
+			out = append(out, repo)
+		}
+	}
+	return out, archivedCount, forkCount
+}
+
+// isExcluded reports whether fullName is listed in exclude, either by its
+// full name or by its owner.
+func isExcluded(exclude []string, fullName string) bool {
+	owner, _, _ := strings.Cut(fullName, "/")
+	return slices.ContainsFunc(exclude, func(s string) bool {
+		return strings.EqualFold(s, fullName) || (!strings.Contains(s, "/") && strings.EqualFold(s, owner))
+	})
+}
@@ -0,0 +1,96 @@
+package git_backup
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterRepositories(t *testing.T) {
+	repos := []*Repository{
+		{FullName: "my-org/api"},
+		{FullName: "my-org/Web"},
+		{FullName: "my-org/sub/tool"},
+		{FullName: "Other/api"},
+	}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "no patterns keep everything",
+			want: []string{"my-org/api", "my-org/Web", "my-org/sub/tool", "Other/api"},
+		},
+		{
+			name:    "include selects direct children only",
+			include: []string{"my-org/*"},
+			want:    []string{"my-org/api", "my-org/Web"},
+		},
+		{
+			name:    "exclude leaves out matches",
+			exclude: []string{"*/api"},
+			want:    []string{"my-org/Web", "my-org/sub/tool"},
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{"my-org/*"},
+			exclude: []string{"my-org/api"},
+			want:    []string{"my-org/Web"},
+		},
+		{
+			name:    "patterns ignore case",
+			include: []string{"MY-ORG/web", "other/*"},
+			want:    []string{"my-org/Web", "Other/api"},
+		},
+		{
+			name:    "exclude ignores case",
+			exclude: []string{"OTHER/*", "my-org/WEB"},
+			want:    []string{"my-org/api", "my-org/sub/tool"},
+		},
+		{
+			name:    "an owner excludes all its repositories",
+			exclude: []string{"MY-ORG"},
+			want:    []string{"Other/api"},
+		},
+		{
+			name:    "nested groups need their own pattern",
+			include: []string{"my-org/*/*"},
+			want:    []string{"my-org/sub/tool"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered, err := FilterRepositories(repos, test.include, test.exclude)
+			if err != nil {
+				t.Fatalf("FilterRepositories() error = %v", err)
+			}
+			got := make([]string, 0, len(filtered))
+			for _, repo := range filtered {
+				got = append(got, repo.FullName)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("FilterRepositories() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterRepositoriesInvalidPattern(t *testing.T) {
+	repos := []*Repository{{FullName: "my-org/api"}}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+	}{
+		{name: "include", include: []string{"my-org/["}},
+		{name: "exclude", exclude: []string{"my-org/api", "[a-"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := FilterRepositories(repos, test.include, test.exclude); err == nil {
+				t.Error("FilterRepositories() error = nil, want an invalid pattern error")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package git_backup
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// GitOptions is the clone_options config section. Its fields map directly
+// onto the go-git clone and fetch options of the same name.
+type GitOptions struct {
+	// SingleBranch only fetches the default branch (CloneOptions.SingleBranch).
+	SingleBranch bool `yaml:"single_branch,omitempty"`
+	// NoCheckout skips checking out a working tree (CloneOptions.NoCheckout).
+	NoCheckout bool `yaml:"no_checkout,omitempty"`
+	// Depth limits the history to this many commits (CloneOptions.Depth and
+	// FetchOptions.Depth). It takes precedence over -backup.depth.
+	Depth int `yaml:"depth,omitempty"`
+	// Tags is one of all, following or none (CloneOptions.Tags and FetchOptions.Tags).
+	Tags string `yaml:"tags,omitempty"`
+}
+
+var tagModes = map[string]git.TagMode{
+	"all":       git.AllTags,
+	"following": git.TagFollowing,
+	"none":      git.NoTags,
+}
+
+// Apply validates the options and copies them into opts.
+func (o *GitOptions) Apply(opts *CloneOptions) error {
+	if o.Depth < 0 {
+		return fmt.Errorf("clone_options.depth must not be negative")
+	}
+	if o.NoCheckout && opts.Bare {
+		return fmt.Errorf("clone_options.no_checkout cannot be combined with bare clones, they never check out")
+	}
+	if o.SingleBranch && opts.Bare {
+		return fmt.Errorf("clone_options.single_branch cannot be combined with bare clones, they back up every branch")
+	}
+	if o.Tags != "" {
+		mode, ok := tagModes[o.Tags]
+		if !ok {
+			return fmt.Errorf("clone_options.tags must be one of all, following or none, got %q", o.Tags)
+		}
+		opts.Tags = mode
+	}
+	opts.SingleBranch = o.SingleBranch
+	opts.NoCheckout = o.NoCheckout
+	if o.Depth != 0 {
+		opts.Depth = o.Depth
+	}
+	return nil
+}
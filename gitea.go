@@ -0,0 +1,208 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// giteaPageSize is the number of repositories requested per page. Gitea
+// may return fewer when its maximum is configured lower.
+const giteaPageSize = 50
+
+type GiteaConfig struct {
+	URL           string   `yaml:"url"`
+	JobName       string   `yaml:"job_name"`
+	AccessToken   string   `yaml:"access_token"`
+	Owned         *bool    `yaml:"owned,omitempty"`
+	Orgs          []string `yaml:"orgs,omitempty"`
+	SkipArchived  *bool    `yaml:"skip_archived,omitempty"`
+	SkipForks     *bool    `yaml:"skip_forks,omitempty"`
+	Include       []string `yaml:"include,omitempty"`
+	Exclude       []string `yaml:"exclude,omitempty"`
+	Canary        string   `yaml:"canary,omitempty"`
+	CanaryAbort   *bool    `yaml:"canary_abort,omitempty"`
+	SSHConfig     `yaml:",inline"`
+	SourceOptions `yaml:",inline"`
+	client        *http.Client
+}
+
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+type giteaRepository struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	// Size is in kilobytes
+	Size     int64 `json:"size"`
+	Archived bool  `json:"archived"`
+	Fork     bool  `json:"fork"`
+}
+
+func (g *GiteaConfig) GetName() string {
+	return g.JobName
+}
+
+func (g *GiteaConfig) GetURL() string {
+	return g.URL
+}
+
+func (g *GiteaConfig) Test() error {
+	if g.URL == "" {
+		return fmt.Errorf("the url of the gitea job is not set")
+	}
+	user := &giteaUser{}
+	if _, err := g.get("/user", user); err != nil {
+		return err
+	}
+	slog.Info("Authenticated with gitea", "user", user.Login)
+	return nil
+}
+
+func (g *GiteaConfig) ListRepositories() ([]*Repository, error) {
+	out := make(map[string]*Repository)
+	paths := make([]string, 0, len(g.Orgs)+1)
+	if *g.Owned {
+		paths = append(paths, "/user/repos")
+	}
+	for _, org := range g.Orgs {
+		paths = append(paths, "/orgs/"+url.PathEscape(org)+"/repos")
+	}
+	for _, path := range paths {
+		repos, err := g.getAllRepos(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			out[repo.FullName] = repo
+		}
+	}
+
+	outSlice := make([]*Repository, 0, len(out))
+	for _, repository := range out {
+		outSlice = append(outSlice, repository)
+	}
+	return outSlice, nil
+}
+
+func (g *GiteaConfig) getAllRepos(path string) ([]*Repository, error) {
+	out := make([]*Repository, 0)
+	for page := 1; ; page++ {
+		repos := make([]*giteaRepository, 0)
+		header, err := g.get(fmt.Sprintf("%s?page=%d&limit=%d", path, page, giteaPageSize), &repos)
+		if err != nil {
+			return out, err
+		}
+		for _, repo := range repos {
+			var gitUrl *url.URL
+			var sshKey *SSHKey
+			var auth transport.AuthMethod
+			if g.useSSH() {
+				if gitUrl, err = parseGitURL(repo.SSHURL); err != nil {
+					return out, err
+				}
+				sshKey = g.sshKey()
+			} else {
+				if gitUrl, err = url.Parse(repo.CloneURL); err != nil {
+					return out, err
+				}
+				auth = &githttp.BasicAuth{Username: "git", Password: g.AccessToken}
+			}
+			out = append(out, &Repository{
+				GitURL:   *gitUrl,
+				FullName: repo.FullName,
+				Size:     repo.Size * 1024,
+				SSHKey:   sshKey,
+				Auth:     auth,
+				Archived: repo.Archived,
+				Fork:     repo.Fork,
+			})
+		}
+		// empty orgs and the page past the last one end the listing, gitea
+		// also reports the total so the empty page is usually not needed
+		total, err := strconv.Atoi(header.Get("X-Total-Count"))
+		if len(repos) == 0 || (err == nil && len(out) >= total) {
+			return out, nil
+		}
+	}
+}
+
+// get requests path from the gitea api and decodes the JSON response into
+// out. It returns the response headers, which hold the pagination.
+func (g *GiteaConfig) get(path string, out any) (http.Header, error) {
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(g.URL, "/")+"/api/v1"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "token "+g.AccessToken)
+	request.Header.Set("Accept", "application/json")
+	response, err := g.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gitea responded to %s with %s", path, response.Status)
+	}
+	return response.Header, json.NewDecoder(response.Body).Decode(out)
+}
+
+func (g *GiteaConfig) Validate() error {
+	if g.URL == "" {
+		return errors.New("url is required")
+	}
+	if g.AccessToken == "" {
+		return errors.New("access_token is required")
+	}
+	if !*g.Owned && len(g.Orgs) == 0 {
+		return errors.New("owned is disabled and no orgs are configured, so no repositories are selected")
+	}
+	if err := validatePatterns(g.Include, g.Exclude); err != nil {
+		return err
+	}
+	if err := g.SourceOptions.validate(); err != nil {
+		return err
+	}
+	return g.SSHConfig.validate()
+}
+
+func (g *GiteaConfig) GetFilter() ([]string, []string) {
+	return g.Include, g.Exclude
+}
+
+func (g *GiteaConfig) GetSkip() (*bool, *bool) {
+	return g.SkipArchived, g.SkipForks
+}
+
+func (g *GiteaConfig) GetCanary() (string, bool) {
+	return g.Canary, *g.CanaryAbort
+}
+
+func (g *GiteaConfig) ClearCredentials() {
+	g.AccessToken = ""
+	g.SSHConfig.clearCredentials()
+}
+
+func (g *GiteaConfig) setDefaults() {
+	if g.Owned == nil {
+		g.Owned = boolPointer(true)
+	}
+	if g.CanaryAbort == nil {
+		g.CanaryAbort = boolPointer(true)
+	}
+	if g.JobName == "" {
+		g.JobName = "Gitea"
+	}
+	// use the default transport, so network flags such as -insecure apply to gitea as well
+	g.client = &http.Client{}
+}
@@ -2,26 +2,35 @@ package git_backup
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
-	"slices"
 	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/go-github/v43/github"
 	"golang.org/x/oauth2"
 )
 
 type GithubConfig struct {
-	JobName      string   `yaml:"job_name"`
-	AccessToken  string   `yaml:"access_token"`
-	URL          string   `yaml:"url,omitempty"`
-	Starred      *bool    `yaml:"starred,omitempty"`
-	OrgMember    *bool    `yaml:"org_member,omitempty"`
-	Collaborator *bool    `yaml:"collaborator,omitempty"`
-	Owned        *bool    `yaml:"owned,omitempty"`
-	Exclude      []string `yaml:"exclude,omitempty"`
-	client       *github.Client
+	JobName       string   `yaml:"job_name"`
+	AccessToken   string   `yaml:"access_token"`
+	URL           string   `yaml:"url,omitempty"`
+	Starred       *bool    `yaml:"starred,omitempty"`
+	OrgMember     *bool    `yaml:"org_member,omitempty"`
+	Collaborator  *bool    `yaml:"collaborator,omitempty"`
+	Owned         *bool    `yaml:"owned,omitempty"`
+	SkipArchived  *bool    `yaml:"skip_archived,omitempty"`
+	SkipForks     *bool    `yaml:"skip_forks,omitempty"`
+	Include       []string `yaml:"include,omitempty"`
+	Exclude       []string `yaml:"exclude,omitempty"`
+	Canary        string   `yaml:"canary,omitempty"`
+	CanaryAbort   *bool    `yaml:"canary_abort,omitempty"`
+	SSHConfig     `yaml:",inline"`
+	SourceOptions `yaml:",inline"`
+	client        *github.Client
 }
 
 func (c *GithubConfig) Test() error {
@@ -29,7 +38,7 @@ func (c *GithubConfig) Test() error {
 	if err != nil {
 		return err
 	}
-	log.Printf("Authenticated with github as: %s", *me.Login)
+	slog.Info("Authenticated with github", "user", *me.Login)
 	return nil
 }
 
@@ -37,6 +46,13 @@ func (c *GithubConfig) GetName() string {
 	return c.JobName
 }
 
+func (c *GithubConfig) GetURL() string {
+	if c.URL == "" {
+		return "https://api.github.com"
+	}
+	return c.URL
+}
+
 func (c *GithubConfig) ListRepositories() ([]*Repository, error) {
 	repos, err := c.getAllRepos()
 	if err != nil {
@@ -44,36 +60,141 @@ func (c *GithubConfig) ListRepositories() ([]*Repository, error) {
 	}
 	out := make([]*Repository, 0, len(repos))
 	for _, repo := range repos {
-		gitUrl, err := url.Parse(*repo.CloneURL)
-		if err != nil {
-			return out, err
+		var gitUrl *url.URL
+		var sshKey *SSHKey
+		var auth transport.AuthMethod
+		if c.useSSH() {
+			if gitUrl, err = parseGitURL(repo.GetSSHURL()); err != nil {
+				return out, err
+			}
+			sshKey = c.sshKey()
+		} else {
+			if gitUrl, err = url.Parse(*repo.CloneURL); err != nil {
+				return out, err
+			}
+			auth = &githttp.BasicAuth{Username: "x-access-token", Password: c.AccessToken}
 		}
-		gitUrl.User = url.UserPassword("github", c.AccessToken)
 
-		isExcluded := slices.ContainsFunc(c.Exclude, func(s string) bool {
-			if strings.EqualFold(s, *repo.FullName) {
-				return true
-			}
+		out = append(out, &Repository{
+			FullName: *repo.FullName,
+			GitURL:   *gitUrl,
+			// github reports the size in kilobytes
+			Size:     int64(repo.GetSize()) * 1024,
+			SSHKey:   sshKey,
+			Auth:     auth,
+			Archived: repo.GetArchived(),
+			Fork:     repo.GetFork(),
+		})
+	}
+	return out, nil
+}
+
+type githubSettings struct {
+	Repository        *github.Repository            `json:"repository"`
+	BranchProtections map[string]*github.Protection `json:"branch_protections,omitempty"`
+	Hooks             []*github.Hook                `json:"hooks,omitempty"`
+	Collaborators     []*github.User                `json:"collaborators,omitempty"`
+}
 
-			if strings.Contains(s, "/") {
-				return false
+func (c *GithubConfig) GetSettings(repo *Repository) (any, error) {
+	owner, name, _ := strings.Cut(repo.FullName, "/")
+	ctx := context.Background()
+
+	repository, _, err := c.client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+	settings := &githubSettings{
+		Repository:        repository,
+		BranchProtections: make(map[string]*github.Protection),
+	}
+
+	// The remaining settings require admin or push access, so we only
+	// include what the token is allowed to see.
+	branchOpts := &github.BranchListOptions{Protected: boolPointer(true), ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		branches, response, err := c.client.Repositories.ListBranches(ctx, owner, name, branchOpts)
+		if err != nil {
+			slog.Warn("Cannot read branch protection", "repo", repo.FullName, "error", err)
+			break
+		}
+		for _, branch := range branches {
+			protection, _, err := c.client.Repositories.GetBranchProtection(ctx, owner, name, branch.GetName())
+			if err != nil {
+				slog.Warn("Cannot read branch protection", "repo", repo.FullName, "branch", branch.GetName(), "error", err)
+				continue
 			}
+			settings.BranchProtections[branch.GetName()] = protection
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		branchOpts.Page = response.NextPage
+	}
 
-			repoFullName := *repo.FullName
+	hookOpts := &github.ListOptions{PerPage: 100}
+	for {
+		hooks, response, err := c.client.Repositories.ListHooks(ctx, owner, name, hookOpts)
+		if err != nil {
+			slog.Warn("Cannot read webhooks", "repo", repo.FullName, "error", err)
+			break
+		}
+		settings.Hooks = append(settings.Hooks, hooks...)
+		if response.NextPage == 0 {
+			break
+		}
+		hookOpts.Page = response.NextPage
+	}
 
-			repoOwner := repoFullName[:strings.Index(repoFullName, "/")]
-			return strings.EqualFold(s, repoOwner)
-		})
-		if isExcluded {
-			log.Printf("Skipping excluded repository: %s", *repo.FullName)
-		} else {
-			out = append(out, &Repository{
-				FullName: *repo.FullName,
-				GitURL:   *gitUrl,
-			})
+	collaboratorOpts := &github.ListCollaboratorsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		collaborators, response, err := c.client.Repositories.ListCollaborators(ctx, owner, name, collaboratorOpts)
+		if err != nil {
+			slog.Warn("Cannot read collaborators", "repo", repo.FullName, "error", err)
+			break
 		}
+		settings.Collaborators = append(settings.Collaborators, collaborators...)
+		if response.NextPage == 0 {
+			break
+		}
+		collaboratorOpts.Page = response.NextPage
 	}
-	return out, nil
+
+	return settings, nil
+}
+
+func (c *GithubConfig) Validate() error {
+	if c.AccessToken == "" {
+		return errors.New("access_token is required")
+	}
+	if !*c.Owned && !*c.Collaborator && !*c.OrgMember && !*c.Starred {
+		return errors.New("owned, collaborator, org_member and starred are all disabled, so no repositories are selected")
+	}
+	if err := validatePatterns(c.Include, c.Exclude); err != nil {
+		return err
+	}
+	if err := c.SourceOptions.validate(); err != nil {
+		return err
+	}
+	return c.SSHConfig.validate()
+}
+
+func (c *GithubConfig) GetFilter() ([]string, []string) {
+	return c.Include, c.Exclude
+}
+
+func (c *GithubConfig) GetSkip() (*bool, *bool) {
+	return c.SkipArchived, c.SkipForks
+}
+
+func (c *GithubConfig) GetCanary() (string, bool) {
+	return c.Canary, *c.CanaryAbort
+}
+
+func (c *GithubConfig) ClearCredentials() {
+	c.AccessToken = ""
+	c.client = nil
+	c.SSHConfig.clearCredentials()
 }
 
 func (c *GithubConfig) setDefaults() {
@@ -92,6 +213,9 @@ func (c *GithubConfig) setDefaults() {
 	if c.Starred == nil {
 		c.Starred = boolPointer(true)
 	}
+	if c.CanaryAbort == nil {
+		c.CanaryAbort = boolPointer(true)
+	}
 	httpClient := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.AccessToken}))
 	if c.URL == "" {
 		c.client = github.NewClient(httpClient)
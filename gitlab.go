@@ -1,35 +1,51 @@
 package git_backup
 
 import (
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"net/url"
-	"slices"
-	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/xanzy/go-gitlab"
 )
 
 type GitLabConfig struct {
-	URL         string   `yaml:"url,omitempty"`
-	JobName     string   `yaml:"job_name"`
-	AccessToken string   `yaml:"access_token"`
-	Starred     *bool    `yaml:"starred,omitempty"`
-	Member      *bool    `yaml:"member,omitempty"`
-	Owned       *bool    `yaml:"owned,omitempty"`
-	Exclude     []string `yaml:"exclude,omitempty"`
-	client      *gitlab.Client
+	URL           string   `yaml:"url,omitempty"`
+	JobName       string   `yaml:"job_name"`
+	AccessToken   string   `yaml:"access_token"`
+	Starred       *bool    `yaml:"starred,omitempty"`
+	Member        *bool    `yaml:"member,omitempty"`
+	Owned         *bool    `yaml:"owned,omitempty"`
+	SkipArchived  *bool    `yaml:"skip_archived,omitempty"`
+	SkipForks     *bool    `yaml:"skip_forks,omitempty"`
+	Include       []string `yaml:"include,omitempty"`
+	Exclude       []string `yaml:"exclude,omitempty"`
+	Canary        string   `yaml:"canary,omitempty"`
+	CanaryAbort   *bool    `yaml:"canary_abort,omitempty"`
+	SSHConfig     `yaml:",inline"`
+	SourceOptions `yaml:",inline"`
+	client        *gitlab.Client
 }
 
 func (g *GitLabConfig) GetName() string {
 	return g.JobName
 }
 
+func (g *GitLabConfig) GetURL() string {
+	if g.URL == "" {
+		return "https://gitlab.com"
+	}
+	return g.URL
+}
+
 func (g *GitLabConfig) Test() error {
 	user, _, err := g.client.Users.CurrentUser()
 	if err != nil {
 		return err
 	}
-	log.Printf("Authenticated as with gitlab as: %s", user.Username)
+	slog.Info("Authenticated with gitlab", "user", user.Username)
 	return nil
 }
 
@@ -68,62 +84,161 @@ func (g *GitLabConfig) ListRepositories() ([]*Repository, error) {
 
 	outSlice := make([]*Repository, 0, len(out))
 	for _, repository := range out {
-		isExcluded := slices.ContainsFunc(g.Exclude, func(s string) bool {
-			if strings.EqualFold(s, repository.FullName) {
-				return true
-			}
+		outSlice = append(outSlice, repository)
+	}
 
-			if strings.Contains(s, "/") {
-				return false
-			}
+	return outSlice, nil
+}
 
-			repoFullName := repository.FullName
+type gitlabSettings struct {
+	Project           *gitlab.Project           `json:"project"`
+	ProtectedBranches []*gitlab.ProtectedBranch `json:"protected_branches,omitempty"`
+	Hooks             []*gitlab.ProjectHook     `json:"hooks,omitempty"`
+	Members           []*gitlab.ProjectMember   `json:"members,omitempty"`
+}
 
-			repoOwner := repoFullName[:strings.Index(repoFullName, "/")]
-			return strings.EqualFold(s, repoOwner)
-		})
-		if isExcluded {
-			log.Printf("Skipping excluded repository: %s", repository.FullName)
-		} else {
-			outSlice = append(outSlice, repository)
+func (g *GitLabConfig) GetSettings(repo *Repository) (any, error) {
+	project, _, err := g.client.Projects.GetProject(repo.FullName, nil)
+	if err != nil {
+		return nil, err
+	}
+	settings := &gitlabSettings{Project: project}
+
+	// The remaining settings require maintainer access, so we only
+	// include what the token is allowed to see.
+	branchOpts := &gitlab.ListProtectedBranchesOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		branches, response, err := g.client.ProtectedBranches.ListProtectedBranches(project.ID, branchOpts)
+		if err != nil {
+			slog.Warn("Cannot read protected branches", "repo", repo.FullName, "error", err)
+			break
+		}
+		settings.ProtectedBranches = append(settings.ProtectedBranches, branches...)
+		if response.NextPage == 0 {
+			break
 		}
+		branchOpts.Page = response.NextPage
 	}
 
-	return outSlice, nil
+	hookOpts := &gitlab.ListProjectHooksOptions{PerPage: 100}
+	for {
+		hooks, response, err := g.client.Projects.ListProjectHooks(project.ID, hookOpts)
+		if err != nil {
+			slog.Warn("Cannot read webhooks", "repo", repo.FullName, "error", err)
+			break
+		}
+		settings.Hooks = append(settings.Hooks, hooks...)
+		if response.NextPage == 0 {
+			break
+		}
+		hookOpts.Page = response.NextPage
+	}
+
+	memberOpts := &gitlab.ListProjectMembersOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		members, response, err := g.client.ProjectMembers.ListAllProjectMembers(project.ID, memberOpts)
+		if err != nil {
+			slog.Warn("Cannot read members", "repo", repo.FullName, "error", err)
+			break
+		}
+		settings.Members = append(settings.Members, members...)
+		if response.NextPage == 0 {
+			break
+		}
+		memberOpts.Page = response.NextPage
+	}
+
+	return settings, nil
 }
 
 func (g *GitLabConfig) getAllRepos(opts *gitlab.ListProjectsOptions) ([]*Repository, error) {
 	out := make([]*Repository, 0)
-	for i := 1; true; i++ {
-		opts.ListOptions.Page = i
-		repos, _, err := g.getRepos(opts)
+	opts.ListOptions.Page = 1
+	for {
+		repos, response, err := g.getRepos(opts)
 		if err != nil {
 			return out, err
 		}
 		for _, repo := range repos {
-			gitUrl, err := url.Parse(repo.HTTPURLToRepo)
-			if err != nil {
-				return out, err
+			// statistics are only returned to members with at least the reporter role
+			var size int64
+			if repo.Statistics != nil {
+				size = repo.Statistics.RepositorySize
+			}
+			var gitUrl *url.URL
+			var sshKey *SSHKey
+			var auth transport.AuthMethod
+			if g.useSSH() {
+				if gitUrl, err = parseGitURL(repo.SSHURLToRepo); err != nil {
+					return out, err
+				}
+				sshKey = g.sshKey()
+			} else {
+				if gitUrl, err = url.Parse(repo.HTTPURLToRepo); err != nil {
+					return out, err
+				}
+				auth = &githttp.BasicAuth{Username: "git", Password: g.AccessToken}
 			}
-			gitUrl.User = url.UserPassword("git", g.AccessToken)
 			out = append(out, &Repository{
 				GitURL:   *gitUrl,
 				FullName: repo.PathWithNamespace,
+				SSHKey:   sshKey,
+				Auth:     auth,
+				Archived: repo.Archived,
+				Fork:     repo.ForkedFromProject != nil,
+				Size:     size,
 			})
 		}
-		if len(repos) == 0 {
+		// gitlab reports no next page on the last one, which saves requesting an empty page
+		if response.NextPage == 0 || len(repos) == 0 {
 			break
 		}
+		opts.ListOptions.Page = response.NextPage
 	}
 	return out, nil
 }
 
 func (g *GitLabConfig) getRepos(opts *gitlab.ListProjectsOptions) ([]*gitlab.Project, *gitlab.Response, error) {
 	opts.ListOptions.PerPage = 100
-	opts.Simple = boolPointer(true)
+	// no simple view, it leaves out the archived and fork fields
+	opts.Statistics = boolPointer(true)
 	return g.client.Projects.ListProjects(opts)
 }
 
+func (g *GitLabConfig) Validate() error {
+	if g.AccessToken == "" {
+		return errors.New("access_token is required")
+	}
+	if !*g.Owned && !*g.Member && !*g.Starred {
+		return errors.New("owned, member and starred are all disabled, so no repositories are selected")
+	}
+	if err := validatePatterns(g.Include, g.Exclude); err != nil {
+		return err
+	}
+	if err := g.SourceOptions.validate(); err != nil {
+		return err
+	}
+	return g.SSHConfig.validate()
+}
+
+func (g *GitLabConfig) GetFilter() ([]string, []string) {
+	return g.Include, g.Exclude
+}
+
+func (g *GitLabConfig) GetSkip() (*bool, *bool) {
+	return g.SkipArchived, g.SkipForks
+}
+
+func (g *GitLabConfig) GetCanary() (string, bool) {
+	return g.Canary, *g.CanaryAbort
+}
+
+func (g *GitLabConfig) ClearCredentials() {
+	g.AccessToken = ""
+	g.client = nil
+	g.SSHConfig.clearCredentials()
+}
+
 func (g *GitLabConfig) setDefaults() {
 	if g.Member == nil {
 		g.Member = boolPointer(true)
@@ -134,16 +249,20 @@ func (g *GitLabConfig) setDefaults() {
 	if g.Starred == nil {
 		g.Starred = boolPointer(true)
 	}
+	if g.CanaryAbort == nil {
+		g.CanaryAbort = boolPointer(true)
+	}
 	if g.JobName == "" {
 		g.JobName = "GitLab"
 	}
-	if g.URL == "" {
-		g.client, _ = gitlab.NewClient(g.AccessToken)
-	} else {
-		client, err := gitlab.NewClient(g.AccessToken, gitlab.WithBaseURL(g.URL))
-		if err != nil {
-			panic(err)
-		}
-		g.client = client
+	// use the default transport, so network flags such as -insecure apply to gitlab as well
+	options := []gitlab.ClientOptionFunc{gitlab.WithHTTPClient(&http.Client{})}
+	if g.URL != "" {
+		options = append(options, gitlab.WithBaseURL(g.URL))
+	}
+	client, err := gitlab.NewClient(g.AccessToken, options...)
+	if err != nil {
+		panic(err)
 	}
+	g.client = client
 }
@@ -0,0 +1,163 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type gitlabPage struct {
+	projects []string
+	nextPage int
+}
+
+// newGitLabServer serves pages of owned projects, by page number starting at
+// 1, and records the pages that were requested.
+func newGitLabServer(t *testing.T, pages map[int]gitlabPage) (*httptest.Server, func() []int) {
+	t.Helper()
+	var mu sync.Mutex
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("owned") != "true" {
+			t.Errorf("projects were requested without owned=true: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("statistics") != "true" {
+			t.Errorf("projects were requested without statistics=true: %s", r.URL.RawQuery)
+		}
+		pageNumber, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		requested = append(requested, pageNumber)
+		mu.Unlock()
+		page, ok := pages[pageNumber]
+		if !ok {
+			t.Errorf("page %d was requested, which does not exist", pageNumber)
+		}
+		projects := make([]map[string]any, 0, len(page.projects))
+		for _, name := range page.projects {
+			projects = append(projects, map[string]any{
+				"path_with_namespace": name,
+				"http_url_to_repo":    "https://gitlab.example.com/" + name + ".git",
+				"ssh_url_to_repo":     "git@gitlab.example.com:" + name + ".git",
+				"statistics":          map[string]any{"repository_size": 1024 * len(name)},
+			})
+		}
+		if page.nextPage != 0 {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page.nextPage))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(projects)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requested)
+	}
+}
+
+func newTestGitLabConfig(url string) *GitLabConfig {
+	config := &GitLabConfig{
+		URL:         url,
+		AccessToken: "secret",
+		Owned:       boolPointer(true),
+		Member:      boolPointer(false),
+		Starred:     boolPointer(false),
+	}
+	config.setDefaults()
+	return config
+}
+
+func TestGitLabListRepositories(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     map[int]gitlabPage
+		want      []string
+		requested []int
+	}{
+		{
+			name:      "single page",
+			pages:     map[int]gitlabPage{1: {projects: []string{"group/a", "group/b"}}},
+			want:      []string{"group/a", "group/b"},
+			requested: []int{1},
+		},
+		{
+			name: "follows the next page",
+			pages: map[int]gitlabPage{
+				1: {projects: []string{"group/a", "group/b"}, nextPage: 2},
+				2: {projects: []string{"group/sub/c"}, nextPage: 3},
+				3: {projects: []string{"other/d"}},
+			},
+			want:      []string{"group/a", "group/b", "group/sub/c", "other/d"},
+			requested: []int{1, 2, 3},
+		},
+		{
+			name: "stops at an empty final page",
+			pages: map[int]gitlabPage{
+				1: {projects: []string{"group/a"}, nextPage: 2},
+				// a next page on an empty page must not be followed
+				2: {nextPage: 3},
+			},
+			want:      []string{"group/a"},
+			requested: []int{1, 2},
+		},
+		{
+			name:      "no projects",
+			pages:     map[int]gitlabPage{1: {}},
+			want:      []string{},
+			requested: []int{1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requested := newGitLabServer(t, test.pages)
+			repos, err := newTestGitLabConfig(server.URL).ListRepositories()
+			if err != nil {
+				t.Fatalf("ListRepositories() error = %v", err)
+			}
+			got := make([]string, 0, len(repos))
+			for _, repo := range repos {
+				got = append(got, repo.FullName)
+				if want := fmt.Sprintf("https://gitlab.example.com/%s.git", repo.FullName); repo.GitURL.String() != want {
+					t.Errorf("GitURL = %s, want %s", repo.GitURL.String(), want)
+				}
+				if repo.Auth == nil {
+					t.Errorf("%s has no credentials", repo.FullName)
+				}
+				if want := int64(1024 * len(repo.FullName)); repo.Size != want {
+					t.Errorf("%s Size = %d, want %d from its statistics", repo.FullName, repo.Size, want)
+				}
+			}
+			sort.Strings(got)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ListRepositories() = %v, want %v", got, test.want)
+			}
+			if !slices.Equal(requested(), test.requested) {
+				t.Errorf("requested pages %v, want %v", requested(), test.requested)
+			}
+		})
+	}
+}
+
+func TestGitLabListRepositoriesError(t *testing.T) {
+	server, _ := newGitLabServer(t, map[int]gitlabPage{1: {projects: []string{"group/a"}}})
+	config := newTestGitLabConfig(server.URL)
+	config.AccessToken = "wrong"
+	config.setDefaults()
+	if _, err := config.ListRepositories(); err == nil {
+		t.Error("ListRepositories() error = nil, want an error for a rejected token")
+	}
+}
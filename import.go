@@ -0,0 +1,89 @@
+package git_backup
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+// FindExistingClone looks for an existing clone of repo in dir, matching on
+// the full name (owner/name) or just the repository name, with or without a
+// .git suffix. As different owners may have repositories with the same name,
+// a clone found by just the name is only used when its origin remote points
+// at repo. It returns an empty string when no clone was found.
+func FindExistingClone(dir string, repo *Repository) string {
+	fullNameCandidates := []string{
+		filepath.Join(dir, filepath.FromSlash(repo.FullName)),
+		filepath.Join(dir, filepath.FromSlash(repo.FullName)+".git"),
+	}
+	for _, candidate := range fullNameCandidates {
+		if _, err := git.PlainOpen(candidate); err == nil {
+			return candidate
+		}
+	}
+	name := path.Base(repo.FullName)
+	nameCandidates := []string{
+		filepath.Join(dir, name),
+		filepath.Join(dir, name+".git"),
+	}
+	for _, candidate := range nameCandidates {
+		if gitRepo, err := git.PlainOpen(candidate); err == nil && originMatches(gitRepo, repo) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// originMatches reports whether the origin remote of gitRepo points at repo.
+func originMatches(gitRepo *git.Repository, repo *Repository) bool {
+	remote, err := gitRepo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return false
+	}
+	for _, remoteURL := range remote.Config().URLs {
+		if repo.Matches(remoteURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adopt copies the existing clone at existingPath to path and points its
+// origin remote at the repository, so the next CloneInto only needs to fetch.
+// The existing clone is left untouched.
+func (r *Repository) Adopt(existingPath string, path string) error {
+	// path may exist as an empty directory, it is replaced by the clone
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return err
+	}
+	if err := copyDir(existingPath, path); err != nil {
+		// leave no partial copy behind, it would be mistaken for a backup
+		_ = os.RemoveAll(path)
+		return err
+	}
+
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := gitRepo.Config()
+	if err != nil {
+		return err
+	}
+	remote, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok {
+		remote = &config.RemoteConfig{
+			Name:  git.DefaultRemoteName,
+			Fetch: []config.RefSpec{config.RefSpec(config.DefaultFetchRefSpec)},
+		}
+		cfg.Remotes[git.DefaultRemoteName] = remote
+	}
+	remote.URLs = []string{r.remoteURL()}
+	return gitRepo.SetConfig(cfg)
+}
@@ -0,0 +1,133 @@
+package git_backup
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// usesLFS reports whether the default branch of the repository at path
+// tracks files with Git LFS, or has an .lfsconfig.
+func usesLFS(path string) (bool, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return false, err
+	}
+	head, err := gitRepo.Head()
+	if err != nil {
+		// empty repositories have no HEAD to look at
+		return false, nil
+	}
+	commit, err := gitRepo.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	if _, err := commit.File(".lfsconfig"); err == nil {
+		return true, nil
+	}
+	attributes, err := commit.File(".gitattributes")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	contents, err := attributes.Contents()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(contents, "filter=lfs"), nil
+}
+
+// ErrLFSQuota is returned when the LFS server refuses to serve the objects
+// because the storage or bandwidth quota of the account is used up. Only
+// buying more quota resolves it, so it is neither retried nor reported as a
+// network failure.
+var ErrLFSQuota = errors.New("git lfs quota exceeded")
+
+// lfsQuotaMessages are the ways LFS servers report an exceeded quota, the
+// first is GitHub's. git-lfs passes on the message of the server, or the
+// status text of a 402 response.
+var lfsQuotaMessages = []string{
+	"over its data quota",
+	"quota exceeded",
+	"payment required",
+}
+
+// fetchLFS fetches all Git LFS objects of the repository at path with the
+// git-lfs binary, as go-git does not support LFS. It uses the clone url and
+// the credentials of the repository rather than the url stored in the clone.
+func (r *Repository) fetchLFS(ctx context.Context, path string, opts CloneOptions) error {
+	if lfs, err := usesLFS(path); err != nil || !lfs {
+		return err
+	}
+	gitBinary, err := exec.LookPath("git")
+	if err != nil {
+		return fmt.Errorf("%s uses Git LFS, fetching its objects requires git to be installed: %w", r.FullName, err)
+	}
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		return fmt.Errorf("%s uses Git LFS, fetching its objects requires git-lfs to be installed (https://git-lfs.com): %w", r.FullName, err)
+	}
+	slog.Info("Fetching Git LFS objects", "repo", r.FullName)
+	auth, err := r.auth(opts)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, gitBinary, "-C", path, "-c", "remote.origin.url="+r.remoteURL(), "lfs", "fetch", "--all", "origin")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if r.GitURL.Scheme == "ssh" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+r.sshCommand(opts))
+	}
+	basicAuth, _ := auth.(*githttp.BasicAuth)
+	if basicAuth != nil {
+		cmd.Env = append(cmd.Env, authHeaderEnv(r.GitURL, basicAuth)...)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		message := redact(output, basicAuth)
+		if isLFSQuotaError(message) {
+			return fmt.Errorf("%w: %s", ErrLFSQuota, message)
+		}
+		return fmt.Errorf("git lfs fetch failed: %w: %s", err, message)
+	}
+	return nil
+}
+
+func isLFSQuotaError(output string) bool {
+	output = strings.ToLower(output)
+	return slices.ContainsFunc(lfsQuotaMessages, func(message string) bool {
+		return strings.Contains(output, message)
+	})
+}
+
+// authHeaderEnv passes the credentials to git as an http.extraHeader for the
+// host of gitURL, through the environment. Unlike the command line, which ps
+// shows to every local user, the environment of a process is only readable by
+// its own user. Scoping the header to the host keeps it from being sent to
+// the storage an LFS server redirects to.
+func authHeaderEnv(gitURL url.URL, auth *githttp.BasicAuth) []string {
+	scope := url.URL{Scheme: gitURL.Scheme, Host: gitURL.Host, Path: "/"}
+	credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + scope.String() + ".extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+	}
+}
+
+// redact removes the password of auth from git output.
+func redact(output []byte, auth *githttp.BasicAuth) string {
+	if auth != nil && auth.Password != "" {
+		return strings.ReplaceAll(string(output), auth.Password, "***")
+	}
+	return string(output)
+}
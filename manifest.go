@@ -0,0 +1,142 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ManifestFileName is the name of the manifest written into the backup folder
+// during each run.
+const ManifestFileName = "manifest.json"
+
+// Manifest describes the outcome of a backup run, for auditing and for
+// comparing runs. It is written after every repository, Finished is only set
+// once the run is done and stays empty when the run crashed.
+type Manifest struct {
+	Started      time.Time        `json:"started"`
+	Finished     *time.Time       `json:"finished,omitempty"`
+	Repositories []*ManifestEntry `json:"repositories"`
+}
+
+type ManifestEntry struct {
+	FullName string `json:"full_name"`
+	Source   string `json:"source"`
+	Path     string `json:"path"`
+	// Refs maps every ref of the backup to the commit it points at.
+	Refs     map[string]string `json:"refs,omitempty"`
+	RefCount int               `json:"ref_count"`
+	// DefaultBranch is the branch HEAD of the backup points at.
+	DefaultBranch string `json:"default_branch,omitempty"`
+	// Empty is set for repositories without any commits.
+	Empty bool `json:"empty,omitempty"`
+	// CommitGraph is set when the backup has a commit-graph file, see
+	// WriteCommitGraph.
+	CommitGraph bool `json:"commit_graph,omitempty"`
+	// Archive and ArchiveLevel are the format and compression level of the
+	// archive made by this run, see -backup.archive.
+	Archive      string `json:"archive,omitempty"`
+	ArchiveLevel int    `json:"archive_level,omitempty"`
+	Size         int64  `json:"size"`
+	Success      bool   `json:"success"`
+	Error        string `json:"error,omitempty"`
+	// Deferred is set for repositories that were not backed up, the backup
+	// size budget had been used up.
+	Deferred bool `json:"deferred,omitempty"`
+	// Disabled is set for repositories that were not backed up, they had
+	// failed too many runs in a row.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Inspect fills in what the manifest records about the backup at path: its
+// refs, the default branch and whether it is empty or has a commit-graph.
+func (e *ManifestEntry) Inspect(path string) {
+	e.Refs = RepositoryRefs(path)
+	e.RefCount = len(e.Refs)
+	e.Empty = e.RefCount == 0
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return
+	}
+	if head, err := gitRepo.Reference(plumbing.HEAD, false); err == nil && head.Type() == plumbing.SymbolicReference {
+		e.DefaultBranch = head.Target().Short()
+	}
+	if gitDir, err := gitDirectory(path); err == nil {
+		e.CommitGraph = hasCommitGraph(gitDir)
+	}
+}
+
+// hasCommitGraph reports whether the git directory at gitDir has a single
+// commit-graph file or a chain of them.
+func hasCommitGraph(gitDir string) bool {
+	for _, name := range []string{"commit-graph", "commit-graphs"} {
+		if _, err := os.Stat(filepath.Join(gitDir, "objects", "info", name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TotalSize is the size of all repositories in the manifest.
+func (m Manifest) TotalSize() int64 {
+	var size int64
+	for _, entry := range m.Repositories {
+		size += entry.Size
+	}
+	return size
+}
+
+// ReadManifest reads the manifest written by WriteManifest at path.
+func ReadManifest(path string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// RepositoryRefs returns the refs of the repository at path for a
+// ManifestEntry, or nil when there is no repository.
+func RepositoryRefs(path string) map[string]string {
+	hashes := refHashes(path)
+	if len(hashes) == 0 {
+		return nil
+	}
+	refs := make(map[string]string, len(hashes))
+	for name, hash := range hashes {
+		refs[name.String()] = hash.String()
+	}
+	return refs
+}
+
+// WriteManifest writes m as JSON to path. The manifest is written next to
+// path first, so an interrupted write never leaves half a manifest behind.
+func WriteManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the backup folder does not exist yet when no repository was backed up
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data next to path first and then renames it, so an
+// interrupted write never leaves half a file behind. Missing parent folders
+// are created.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,66 @@
+package git_backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ManifestFileName)
+	finished := time.Date(2026, 1, 15, 2, 5, 0, 0, time.UTC)
+	written := Manifest{
+		Started:  time.Date(2026, 1, 15, 2, 0, 0, 0, time.UTC),
+		Finished: &finished,
+		Repositories: []*ManifestEntry{
+			{FullName: "my-org/a", Source: "GitHub", Size: 1024, Success: true},
+			{FullName: "my-org/b", Source: "GitHub", Size: 2048, Error: "authentication required"},
+		},
+	}
+	if err := WriteManifest(path, written); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	if !read.Started.Equal(written.Started) || read.Finished == nil || !read.Finished.Equal(finished) || len(read.Repositories) != 2 || read.Repositories[1].Error != "authentication required" {
+		t.Errorf("ReadManifest() = %+v, want %+v", read, written)
+	}
+	if size := read.TotalSize(); size != 3072 {
+		t.Errorf("TotalSize() = %d, want 3072", size)
+	}
+	if _, err := ReadManifest(filepath.Join(t.TempDir(), ManifestFileName)); err == nil {
+		t.Error("ReadManifest() of a missing manifest error = nil")
+	}
+}
+
+func TestManifestEntryInspect(t *testing.T) {
+	path, commit := newTestRepository(t, map[string]string{"README.md": "# test\n"})
+	var entry ManifestEntry
+	entry.Inspect(path)
+	if entry.RefCount != 1 || entry.Refs["refs/heads/master"] != commit.String() {
+		t.Errorf("Refs = %v, RefCount = %d, want refs/heads/master at %s", entry.Refs, entry.RefCount, commit)
+	}
+	if entry.DefaultBranch != "master" {
+		t.Errorf("DefaultBranch = %q, want master", entry.DefaultBranch)
+	}
+	if entry.Empty || entry.CommitGraph {
+		t.Errorf("Empty = %v, CommitGraph = %v, want false for both", entry.Empty, entry.CommitGraph)
+	}
+
+	if err := os.WriteFile(filepath.Join(path, ".git", "objects", "info", "commit-graph"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry.Inspect(path)
+	if !entry.CommitGraph {
+		t.Error("CommitGraph = false for a repository with a commit-graph file")
+	}
+
+	var missing ManifestEntry
+	missing.Inspect(t.TempDir())
+	if !missing.Empty || missing.RefCount != 0 || missing.DefaultBranch != "" {
+		t.Errorf("Inspect() of a folder without a repository = %+v, want an empty entry", missing)
+	}
+}
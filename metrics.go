@@ -0,0 +1,144 @@
+package git_backup
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the duration
+// histograms: from a fetch without anything new to the clone of a huge
+// repository.
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// PushgatewayNotifier pushes the result of a backup run as metrics to a
+// Prometheus Pushgateway, which suits a batch job better than a metrics
+// endpoint. The metrics of a run replace those of the previous run, so a
+// failure category or source that is gone does not linger. Only
+// git_backup_last_success_timestamp is pushed to a group of its own,
+// labeled result="success", which keeps the time of the last successful run
+// when a run fails.
+type PushgatewayNotifier struct {
+	URL string
+	Job string
+}
+
+func (n *PushgatewayNotifier) Notify(result BackupResult) error {
+	var metrics strings.Builder
+	writeMetric(&metrics, "git_backup_repos_total", "gauge", "Repositories backed up in the last run.", float64(result.Repositories))
+	writeMetric(&metrics, "git_backup_changed_total", "gauge", "Repositories that changed in the last run.", float64(result.Changed))
+	writeMetric(&metrics, "git_backup_skipped_total", "gauge", "Repositories skipped because their refs had not changed in the last run.", float64(result.Skipped))
+	writeMetric(&metrics, "git_backup_errors_total", "gauge", "Errors encountered in the last run.", float64(result.Errors))
+	interrupted := 0.0
+	if result.Interrupted {
+		interrupted = 1
+	}
+	writeMetric(&metrics, "git_backup_interrupted", "gauge", "1 if the last run was interrupted by a signal.", interrupted)
+	writeMetric(&metrics, "git_backup_duration_seconds", "gauge", "Duration of the last run.", result.Duration.Seconds())
+	writeMetric(&metrics, "git_backup_size_bytes", "gauge", "Size on disk of the backed up repositories.", float64(result.TotalBytes))
+	sources := make([]string, 0, len(result.SourceBytes))
+	for source := range result.SourceBytes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	metrics.WriteString("# HELP git_backup_source_size_bytes Size on disk of the backed up repositories of a source.\n")
+	metrics.WriteString("# TYPE git_backup_source_size_bytes gauge\n")
+	for _, source := range sources {
+		fmt.Fprintf(&metrics, "git_backup_source_size_bytes{source=%q} %d\n", source, result.SourceBytes[source])
+	}
+	writeHistogramHeader(&metrics, "git_backup_clone_duration_seconds", "How long cloning or fetching each repository took in the last run.")
+	writeHistogram(&metrics, "git_backup_clone_duration_seconds", "", result.CloneDurations)
+	listSources := make([]string, 0, len(result.ListDurations))
+	for source := range result.ListDurations {
+		listSources = append(listSources, source)
+	}
+	sort.Strings(listSources)
+	writeHistogramHeader(&metrics, "git_backup_list_duration_seconds", "How long listing the repositories of each source took in the last run.")
+	for _, source := range listSources {
+		writeHistogram(&metrics, "git_backup_list_duration_seconds", fmt.Sprintf("source=%q,", source), []time.Duration{result.ListDurations[source]})
+	}
+	categories := make(map[FailureCategory]int)
+	for _, failure := range result.Failures {
+		categories[failure.Category]++
+	}
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, string(category))
+	}
+	sort.Strings(names)
+	metrics.WriteString("# HELP git_backup_failures_total Repositories that failed in the last run, by category.\n")
+	metrics.WriteString("# TYPE git_backup_failures_total gauge\n")
+	for _, category := range names {
+		fmt.Fprintf(&metrics, "git_backup_failures_total{category=%q} %d\n", category, categories[FailureCategory(category)])
+	}
+
+	job := n.Job
+	if job == "" {
+		job = "git-backup"
+	}
+	groupURL := strings.TrimSuffix(n.URL, "/") + "/metrics/job/" + url.PathEscape(job)
+	if err := pushMetrics(groupURL, metrics.String()); err != nil {
+		return err
+	}
+	if !result.Success() {
+		return nil
+	}
+	var success strings.Builder
+	writeMetric(&success, "git_backup_last_success_timestamp", "gauge", "Unix time of the last successful run.", float64(time.Now().Unix()))
+	return pushMetrics(groupURL+"/result/success", success.String())
+}
+
+// pushMetrics replaces the metrics of the Pushgateway group at groupURL.
+func pushMetrics(groupURL string, metrics string) error {
+	request, err := http.NewRequest(http.MethodPut, groupURL, strings.NewReader(metrics))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	response, err := pingClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s responded with %s", groupURL, response.Status)
+	}
+	return nil
+}
+
+func writeMetric(metrics *strings.Builder, name, kind, help string, value float64) {
+	fmt.Fprintf(metrics, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+func writeHistogramHeader(metrics *strings.Builder, name, help string) {
+	fmt.Fprintf(metrics, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+}
+
+// writeHistogram writes the _bucket, _sum and _count series of a histogram of
+// durations over durationBuckets. labels, if any, are written in front of the
+// le label of the buckets and end with a comma.
+func writeHistogram(metrics *strings.Builder, name, labels string, durations []time.Duration) {
+	sum := 0.0
+	counts := make([]int, len(durationBuckets))
+	for _, duration := range durations {
+		seconds := duration.Seconds()
+		sum += seconds
+		for i, bucket := range durationBuckets {
+			if seconds <= bucket {
+				counts[i]++
+			}
+		}
+	}
+	for i, bucket := range durationBuckets {
+		fmt.Fprintf(metrics, "%s_bucket{%sle=\"%g\"} %d\n", name, labels, bucket, counts[i])
+	}
+	fmt.Fprintf(metrics, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, len(durations))
+	seriesLabels := ""
+	if labels != "" {
+		seriesLabels = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	fmt.Fprintf(metrics, "%s_sum%s %g\n%s_count%s %d\n", name, seriesLabels, sum, name, seriesLabels, len(durations))
+}
@@ -0,0 +1,116 @@
+package git_backup
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pushedGroup struct {
+	method string
+	body   string
+}
+
+// newPushgateway records the last push to every group, by path.
+func newPushgateway(t *testing.T) (*httptest.Server, func() map[string]pushedGroup) {
+	t.Helper()
+	var mu sync.Mutex
+	groups := make(map[string]pushedGroup)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		groups[r.URL.Path] = pushedGroup{method: r.Method, body: string(body)}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() map[string]pushedGroup {
+		mu.Lock()
+		defer mu.Unlock()
+		pushed := make(map[string]pushedGroup, len(groups))
+		for path, group := range groups {
+			pushed[path] = group
+		}
+		return pushed
+	}
+}
+
+func TestPushgatewayNotifier(t *testing.T) {
+	server, pushed := newPushgateway(t)
+	notifier := &PushgatewayNotifier{URL: server.URL + "/"}
+
+	failed := BackupResult{
+		Repositories: 2,
+		Errors:       1,
+		Failures:     []Failure{{Repository: "my-org/a", Category: FailureAuth}},
+		SourceBytes:  map[string]int64{"GitHub": 1024},
+		// a fetch without anything new, a 2 minute clone and one that timed out
+		CloneDurations: []time.Duration{500 * time.Millisecond, 2 * time.Minute, 2 * time.Hour},
+		ListDurations:  map[string]time.Duration{"GitHub": 3 * time.Second},
+	}
+	if err := notifier.Notify(failed); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	groups := pushed()
+	run, ok := groups["/metrics/job/git-backup"]
+	if !ok {
+		t.Fatalf("no metrics were pushed to the job group, got %v", groups)
+	}
+	if run.method != http.MethodPut {
+		t.Errorf("run metrics were pushed with %s, want PUT to replace the previous run", run.method)
+	}
+	for _, want := range []string{
+		"git_backup_repos_total 2",
+		`git_backup_failures_total{category="auth"} 1`,
+		`git_backup_source_size_bytes{source="GitHub"} 1024`,
+		"# TYPE git_backup_clone_duration_seconds histogram",
+		`git_backup_clone_duration_seconds_bucket{le="1"} 1`,
+		`git_backup_clone_duration_seconds_bucket{le="60"} 1`,
+		`git_backup_clone_duration_seconds_bucket{le="120"} 2`,
+		`git_backup_clone_duration_seconds_bucket{le="3600"} 2`,
+		`git_backup_clone_duration_seconds_bucket{le="+Inf"} 3`,
+		"git_backup_clone_duration_seconds_sum 7320.5",
+		"git_backup_clone_duration_seconds_count 3",
+		`git_backup_list_duration_seconds_bucket{source="GitHub",le="1"} 0`,
+		`git_backup_list_duration_seconds_bucket{source="GitHub",le="5"} 1`,
+		`git_backup_list_duration_seconds_sum{source="GitHub"} 3`,
+		`git_backup_list_duration_seconds_count{source="GitHub"} 1`,
+	} {
+		if !strings.Contains(run.body, want) {
+			t.Errorf("run metrics do not contain %q:\n%s", want, run.body)
+		}
+	}
+	if _, ok := groups["/metrics/job/git-backup/result/success"]; ok {
+		t.Error("a failed run pushed git_backup_last_success_timestamp")
+	}
+
+	if err := notifier.Notify(BackupResult{Repositories: 2}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	groups = pushed()
+	if strings.Contains(groups["/metrics/job/git-backup"].body, "git_backup_last_success_timestamp") {
+		t.Error("git_backup_last_success_timestamp is in the run group, the next failed run would remove it")
+	}
+	success := groups["/metrics/job/git-backup/result/success"]
+	if !strings.Contains(success.body, "git_backup_last_success_timestamp ") {
+		t.Errorf("a successful run did not push git_backup_last_success_timestamp, got %q", success.body)
+	}
+}
+
+func TestPushgatewayNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	notifier := &PushgatewayNotifier{URL: server.URL, Job: "nightly"}
+	if err := notifier.Notify(BackupResult{}); err == nil {
+		t.Error("Notify() error = nil, want the rejected push to be reported")
+	}
+}
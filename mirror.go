@@ -0,0 +1,114 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// MirrorConfig is the mirror config section. After a repository is backed
+// up, its branches and tags are force pushed to URL/<full name>.git on a
+// secondary git server. The repositories are not created through an API, so
+// the server must create them on push (GitLab does, Gitea and Forgejo do
+// with push-to-create enabled) or they must exist already.
+type MirrorConfig struct {
+	URL string `yaml:"url"`
+	// Username and AccessToken authenticate https pushes. The username
+	// defaults to git.
+	Username    string `yaml:"username,omitempty"`
+	AccessToken string `yaml:"access_token,omitempty"`
+	// Verify lists the refs of the mirror after each push and fails the
+	// repository when they don't match the backup.
+	Verify    bool `yaml:"verify,omitempty"`
+	SSHConfig `yaml:",inline"`
+}
+
+func (m *MirrorConfig) compile() error {
+	if m.URL == "" {
+		return fmt.Errorf("mirror.url is required")
+	}
+	if _, err := parseGitURL(m.URL); err != nil {
+		return fmt.Errorf("invalid mirror.url: %w", err)
+	}
+	return nil
+}
+
+// Target returns the repository on the secondary server that fullName is
+// mirrored to.
+func (m *MirrorConfig) Target(fullName string) (*Repository, error) {
+	gitURL, err := parseGitURL(m.URL)
+	if err != nil {
+		return nil, err
+	}
+	gitURL.Path = path.Join("/", gitURL.Path, fullName+".git")
+	target := &Repository{GitURL: *gitURL, FullName: fullName}
+	if m.useSSH() {
+		target.SSHKey = m.sshKey()
+	} else if m.AccessToken != "" {
+		username := m.Username
+		if username == "" {
+			username = "git"
+		}
+		target.Auth = &githttp.BasicAuth{Username: username, Password: m.AccessToken}
+	}
+	return target, nil
+}
+
+// MirrorRepository force pushes the branches and tags of the backup at path
+// to target, so the secondary server matches the backup. Branches and tags
+// that were deleted upstream are not deleted from target. With verify, the
+// refs of target are listed after the push and compared to the pushed ones,
+// a hook on the server may have rejected some of them without failing the
+// push.
+func MirrorRepository(ctx context.Context, path string, target *Repository, opts CloneOptions, verify bool) error {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+	pushed, err := pushBackup(ctx, gitRepo, path, target, opts)
+	if err != nil {
+		return fmt.Errorf("mirror push to %s: %w", target.GitURL.Redacted(), err)
+	}
+	if verify {
+		if err := verifyMirror(ctx, target, pushed, opts); err != nil {
+			return fmt.Errorf("mirror %s: %w", target.GitURL.Redacted(), err)
+		}
+	}
+	return nil
+}
+
+// verifyMirror checks that the refs of target point at the commits and tags
+// that were pushed to it.
+func verifyMirror(ctx context.Context, target *Repository, pushed []RestoredRef, opts CloneOptions) error {
+	auth, err := target.auth(opts)
+	if err != nil {
+		return err
+	}
+	refs, err := target.listRemote(ctx, auth)
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return fmt.Errorf("list refs to verify the push: %w", err)
+	}
+	mirrored := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+	for _, ref := range refs {
+		mirrored[ref.Name()] = ref.Hash()
+	}
+	mismatches := make([]string, 0)
+	for _, ref := range pushed {
+		if hash, ok := mirrored[ref.Name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s is missing", ref.Name))
+		} else if hash != ref.Hash {
+			mismatches = append(mismatches, fmt.Sprintf("%s is at %s instead of %s", ref.Name, hash, ref.Hash))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("does not match the backup: %s", strings.Join(mismatches, ", "))
+	}
+	return nil
+}
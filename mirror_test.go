@@ -0,0 +1,43 @@
+package git_backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestMirrorRepositoryVerify(t *testing.T) {
+	backup, commit := newTestRepository(t, map[string]string{"README.md": "# test\n"})
+	mirrorPath := t.TempDir()
+	if _, err := git.PlainInit(mirrorPath, true); err != nil {
+		t.Fatal(err)
+	}
+	target := newFileRepository(t, mirrorPath)
+	if err := MirrorRepository(context.Background(), backup, target, CloneOptions{}, true); err != nil {
+		t.Fatalf("MirrorRepository() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		pushed []RestoredRef
+		want   string
+	}{
+		{name: "match", pushed: []RestoredRef{{Name: "refs/heads/master", Hash: commit}}},
+		{name: "missing", pushed: []RestoredRef{{Name: "refs/heads/master", Hash: commit}, {Name: "refs/tags/v1", Hash: commit}}, want: "refs/tags/v1 is missing"},
+		{name: "different", pushed: []RestoredRef{{Name: "refs/heads/master", Hash: plumbing.NewHash(strings.Repeat("1", 40))}}, want: "refs/heads/master is at " + commit.String()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyMirror(context.Background(), target, test.pushed, CloneOptions{})
+			if test.want == "" && err != nil {
+				t.Errorf("verifyMirror() error = %v, want nil", err)
+			}
+			if test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+				t.Errorf("verifyMirror() error = %v, want it to contain %q", err, test.want)
+			}
+		})
+	}
+}
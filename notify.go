@@ -0,0 +1,203 @@
+package git_backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BackupResult summarizes a backup run for notifiers. Skipped counts the
+// repositories that were not fetched because their refs had not changed
+// since the last run. Failures lists every failed repository with its
+// category, including those that failed verification. TotalBytes is the size
+// on disk of all backed up repositories, SourceBytes breaks it down by source.
+// Interrupted is set when the run was stopped by a signal before it was done.
+// Statuses has the outcome of every repository the run got to.
+type BackupResult struct {
+	Repositories int              `json:"repositories"`
+	Changed      int              `json:"changed"`
+	Skipped      int              `json:"skipped"`
+	Errors       int              `json:"errors"`
+	Failures     []Failure        `json:"failures,omitempty"`
+	TotalBytes   int64            `json:"total_bytes"`
+	SourceBytes  map[string]int64 `json:"source_bytes,omitempty"`
+	// PreviousBytes is the total size of the previous run according to its
+	// manifest, or nil when there is none.
+	PreviousBytes *int64        `json:"previous_total_bytes,omitempty"`
+	Duration      time.Duration `json:"duration_ns"`
+	// CloneDurations is how long the clone or fetch of each repository took,
+	// ListDurations how long listing the repositories of each source took.
+	CloneDurations []time.Duration          `json:"clone_durations_ns,omitempty"`
+	ListDurations  map[string]time.Duration `json:"list_durations_ns,omitempty"`
+	Interrupted    bool                     `json:"interrupted,omitempty"`
+	Summary        string                   `json:"summary"`
+	Statuses       []RepositoryStatus       `json:"statuses,omitempty"`
+}
+
+// Outcome is what happened to a repository in a run.
+type Outcome string
+
+const (
+	// OutcomeChanged repositories were fetched and had new commits or refs.
+	OutcomeChanged Outcome = "changed"
+	// OutcomeUnchanged repositories were fetched without anything new.
+	OutcomeUnchanged Outcome = "unchanged"
+	// OutcomeSkipped repositories were not fetched, their refs had not
+	// changed since the last run.
+	OutcomeSkipped Outcome = "skipped"
+	OutcomeFailed  Outcome = "failed"
+	// OutcomeDeferred repositories were not backed up, the backup size
+	// budget had been used up.
+	OutcomeDeferred Outcome = "deferred"
+	// OutcomeDisabled repositories were not backed up, they had failed
+	// -backup.max-consecutive-failures runs in a row.
+	OutcomeDisabled Outcome = "disabled"
+)
+
+// RepositoryStatus is the outcome of one repository in a run. Failure is set
+// for failed repositories.
+type RepositoryStatus struct {
+	Repository string        `json:"repository"`
+	Source     string        `json:"source"`
+	Outcome    Outcome       `json:"outcome"`
+	Size       int64         `json:"size"`
+	Duration   time.Duration `json:"duration_ns"`
+	Failure    *Failure      `json:"failure,omitempty"`
+}
+
+// TotalSize formats the total size, followed by how much it grew or shrunk
+// since the previous run when that is known. A sudden jump points at a new
+// huge repository, or repositories that are cloned again on every run.
+func (r BackupResult) TotalSize() string {
+	size := FormatSize(r.TotalBytes)
+	if r.PreviousBytes == nil {
+		return size
+	}
+	delta := r.TotalBytes - *r.PreviousBytes
+	if delta < 0 {
+		return fmt.Sprintf("%s (-%s since the last run)", size, FormatSize(-delta))
+	}
+	return fmt.Sprintf("%s (+%s since the last run)", size, FormatSize(delta))
+}
+
+// Success reports whether the run finished, without errors.
+func (r BackupResult) Success() bool {
+	return r.Errors == 0 && !r.Interrupted
+}
+
+// The outcomes of a run that notify_routes route on, see BackupResult.RunOutcome.
+const (
+	RunSuccess     = "success"
+	RunFailure     = "failure"
+	RunInterrupted = "interrupted"
+)
+
+// RunOutcome is the outcome of the whole run: success, failure or interrupted.
+func (r BackupResult) RunOutcome() string {
+	if r.Interrupted {
+		return RunInterrupted
+	}
+	if r.Errors > 0 {
+		return RunFailure
+	}
+	return RunSuccess
+}
+
+// Notifier sends the result of a backup run somewhere.
+type Notifier interface {
+	Notify(result BackupResult) error
+}
+
+// NotifierNames are the names notify_routes refer to the notifiers by, one
+// for each notifier the command line flags configure.
+var NotifierNames = []string{"webhook", "slack", "email", "pushgateway", "report", "junit"}
+
+// NamedNotifier is a Notifier with one of the NotifierNames.
+type NamedNotifier struct {
+	Name string
+	Notifier
+}
+
+// NotifyRoute is an entry of the notify_routes config section. The results
+// of runs with Outcome are sent to the Notifiers it names.
+type NotifyRoute struct {
+	Outcome   string   `yaml:"outcome"`
+	Notifiers []string `yaml:"notifiers"`
+}
+
+func (r *NotifyRoute) compile() error {
+	if r.Outcome != RunSuccess && r.Outcome != RunFailure && r.Outcome != RunInterrupted {
+		return fmt.Errorf("notify_routes outcome must be one of success, failure or interrupted, got %q", r.Outcome)
+	}
+	for _, name := range r.Notifiers {
+		if !slices.Contains(NotifierNames, name) {
+			return fmt.Errorf("notify_routes refers to the unknown notifier %q, expected one of %s", name, strings.Join(NotifierNames, ", "))
+		}
+	}
+	return nil
+}
+
+// RouteNotifiers picks the notifiers a result with the given outcome is sent
+// to. Notifiers that no route names get every result, the ones that are
+// named only the results of the outcomes of their routes.
+func RouteNotifiers(notifiers []NamedNotifier, routes []*NotifyRoute, outcome string) []Notifier {
+	routed := make(map[string]bool)
+	wanted := make(map[string]bool)
+	for _, route := range routes {
+		for _, name := range route.Notifiers {
+			routed[name] = true
+			if route.Outcome == outcome {
+				wanted[name] = true
+			}
+		}
+	}
+	selected := make([]Notifier, 0, len(notifiers))
+	for _, notifier := range notifiers {
+		if !routed[notifier.Name] || wanted[notifier.Name] {
+			selected = append(selected, notifier.Notifier)
+		}
+	}
+	return selected
+}
+
+// NotifyAll sends result to every notifier, and returns the errors of the
+// ones that failed.
+func NotifyAll(notifiers []Notifier, result BackupResult) error {
+	var errs []error
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookNotifier POSTs the BackupResult as JSON to URL.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n *WebhookNotifier) Notify(result BackupResult) error {
+	return postJSON(n.URL, result)
+}
+
+func postJSON(url string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	response, err := pingClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s responded with %s", url, response.Status)
+	}
+	return nil
+}
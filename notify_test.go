@@ -0,0 +1,94 @@
+package git_backup
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBackupResultTotalSize(t *testing.T) {
+	size := func(bytes int64) *int64 {
+		return &bytes
+	}
+	tests := []struct {
+		name     string
+		total    int64
+		previous *int64
+		want     string
+	}{
+		{name: "no previous run", total: 2048, want: "2.0 KB"},
+		{name: "grown", total: 3072, previous: size(1024), want: "3.0 KB (+2.0 KB since the last run)"},
+		{name: "shrunk", total: 1024, previous: size(3072), want: "1.0 KB (-2.0 KB since the last run)"},
+		{name: "unchanged", total: 1024, previous: size(1024), want: "1.0 KB (+0 B since the last run)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := BackupResult{TotalBytes: test.total, PreviousBytes: test.previous}
+			if got := result.TotalSize(); got != test.want {
+				t.Errorf("TotalSize() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouteNotifiers(t *testing.T) {
+	notifiers := []NamedNotifier{
+		{Name: "slack", Notifier: &WebhookNotifier{URL: "slack"}},
+		{Name: "email", Notifier: &WebhookNotifier{URL: "email"}},
+		{Name: "report", Notifier: &WebhookNotifier{URL: "report"}},
+	}
+	routes := []*NotifyRoute{
+		{Outcome: RunSuccess, Notifiers: []string{"slack"}},
+		{Outcome: RunFailure, Notifiers: []string{"slack", "email"}},
+	}
+	tests := []struct {
+		outcome string
+		want    []string
+	}{
+		// the report is named by no route and gets every result
+		{outcome: RunSuccess, want: []string{"slack", "report"}},
+		{outcome: RunFailure, want: []string{"slack", "email", "report"}},
+		{outcome: RunInterrupted, want: []string{"report"}},
+	}
+	for _, test := range tests {
+		t.Run(test.outcome, func(t *testing.T) {
+			routed := RouteNotifiers(notifiers, routes, test.outcome)
+			got := make([]string, 0, len(routed))
+			for _, notifier := range routed {
+				got = append(got, notifier.(*WebhookNotifier).URL)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("RouteNotifiers(%s) = %v, want %v", test.outcome, got, test.want)
+			}
+		})
+	}
+	if got := RouteNotifiers(notifiers, nil, RunFailure); len(got) != len(notifiers) {
+		t.Errorf("without routes %d notifiers are used, want all %d", len(got), len(notifiers))
+	}
+}
+
+func TestNotifyRouteInvalid(t *testing.T) {
+	for _, route := range []NotifyRoute{
+		{Outcome: "warning", Notifiers: []string{"slack"}},
+		{Outcome: RunFailure, Notifiers: []string{"pagerduty"}},
+	} {
+		if err := route.compile(); err == nil {
+			t.Errorf("compile() of %+v error = nil, want an error", route)
+		}
+	}
+}
+
+func TestBackupResultRunOutcome(t *testing.T) {
+	tests := []struct {
+		result BackupResult
+		want   string
+	}{
+		{result: BackupResult{}, want: RunSuccess},
+		{result: BackupResult{Errors: 1}, want: RunFailure},
+		{result: BackupResult{Errors: 1, Interrupted: true}, want: RunInterrupted},
+	}
+	for _, test := range tests {
+		if got := test.result.RunOutcome(); got != test.want {
+			t.Errorf("RunOutcome() of %+v = %s, want %s", test.result, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package git_backup
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// WriteCommitGraph writes a commit-graph file and repacks the repository at
+// path with a reachability bitmap, which speeds up later fetches and any
+// analysis of the backup. go-git cannot write these, so this requires git.
+// Empty repositories have nothing to optimize and are skipped.
+func WriteCommitGraph(path string) error {
+	gitDir, err := gitDirectory(path)
+	if err != nil {
+		return err
+	}
+	if len(refHashes(path)) == 0 {
+		return nil
+	}
+	gitBinary, err := exec.LookPath("git")
+	if err != nil {
+		return fmt.Errorf("writing commit-graph files requires git to be installed: %w", err)
+	}
+	commands := [][]string{
+		{"commit-graph", "write", "--reachable"},
+		{"repack", "-a", "-d", "-b"},
+	}
+	for _, args := range commands {
+		// --git-dir rather than -C, git must never search upward and touch an enclosing repository
+		cmd := exec.Command(gitBinary, append([]string{"--git-dir", gitDir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w: %s", args[0], err, output)
+		}
+	}
+	return nil
+}
+
+// gitDirectory returns the git directory of the repository at path: path
+// itself for bare clones, its .git folder otherwise. It fails when path does
+// not hold a repository.
+func gitDirectory(path string) (string, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	bare, err := isBare(gitRepo)
+	if err != nil {
+		return "", err
+	}
+	if bare {
+		return path, nil
+	}
+	return filepath.Join(path, git.GitDirName), nil
+}
@@ -0,0 +1,81 @@
+package git_backup
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeletedFolder is the folder in a source's folder that MoveOrphan moves
+// orphaned backups into. Being hidden, FindOrphans never returns it.
+const DeletedFolder = ".deleted"
+
+// FindOrphans returns the folders under sourcePath that do not belong to any
+// of repos, the repositories the source listed. These are left behind by
+// repositories that were renamed or deleted upstream. Only the top-most
+// orphaned folder is returned, e.g. the folder of a whole organization when
+// none of its repositories are listed anymore. Hidden folders directly in
+// sourcePath, such as .meta, are not backups and never returned.
+//
+// Paths are compared case-insensitively: a repository renamed to a different
+// case is backed up into its old folder on case-insensitive file systems, and
+// must not be mistaken for an orphan.
+func FindOrphans(sourcePath string, repos []*Repository) ([]string, error) {
+	sourcePath = filepath.Clean(sourcePath)
+	expected := make(map[string]bool, len(repos))
+	ancestors := make(map[string]bool)
+	for _, repo := range repos {
+		path := filepath.Join(sourcePath, repo.FullName)
+		expected[strings.ToLower(path)] = true
+		for parent := filepath.Dir(path); len(parent) > len(sourcePath); parent = filepath.Dir(parent) {
+			ancestors[strings.ToLower(parent)] = true
+		}
+	}
+
+	orphans := make([]string, 0)
+	err := filepath.WalkDir(sourcePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == sourcePath && os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if path == sourcePath || !entry.IsDir() {
+			return nil
+		}
+		if filepath.Dir(path) == sourcePath && strings.HasPrefix(entry.Name(), ".") {
+			return fs.SkipDir
+		}
+		key := strings.ToLower(path)
+		if expected[key] {
+			return fs.SkipDir
+		}
+		if ancestors[key] {
+			return nil
+		}
+		orphans = append(orphans, path)
+		return fs.SkipDir
+	})
+	return orphans, err
+}
+
+// MoveOrphan moves the orphaned folder at path, found by FindOrphans, to the
+// same place below the DeletedFolder of sourcePath and returns where it was
+// moved to. A folder already moved there earlier gets the current time
+// appended to its name rather than being replaced.
+func MoveOrphan(sourcePath string, path string) (string, error) {
+	rel, err := filepath.Rel(sourcePath, path)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(sourcePath, DeletedFolder, rel)
+	if _, err := os.Stat(target); err == nil {
+		target += "." + time.Now().UTC().Format(archiveTimeFormat)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", err
+	}
+	return target, os.Rename(path, target)
+}
@@ -0,0 +1,52 @@
+package git_backup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMoveOrphan(t *testing.T) {
+	sourcePath := t.TempDir()
+	for _, dir := range []string{"my-org/kept", "my-org/gone", "other/old"} {
+		if err := os.MkdirAll(filepath.Join(sourcePath, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed := []*Repository{{FullName: "my-org/kept"}}
+
+	orphans, err := FindOrphans(sourcePath, listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(sourcePath, "my-org", "gone"), filepath.Join(sourcePath, "other")}
+	if !slices.Equal(orphans, want) {
+		t.Fatalf("FindOrphans() = %v, want %v", orphans, want)
+	}
+	for _, orphan := range orphans {
+		if _, err := MoveOrphan(sourcePath, orphan); err != nil {
+			t.Fatalf("MoveOrphan(%s) error = %v", orphan, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(sourcePath, DeletedFolder, "my-org", "gone")); err != nil {
+		t.Errorf("the orphan was not moved below %s: %v", DeletedFolder, err)
+	}
+	// the moved folders are not orphans themselves
+	if orphans, err := FindOrphans(sourcePath, listed); err != nil || len(orphans) != 0 {
+		t.Errorf("FindOrphans() after moving = %v, %v, want none", orphans, err)
+	}
+
+	// a repository that is orphaned again does not replace the earlier one
+	if err := os.MkdirAll(filepath.Join(sourcePath, "my-org", "gone"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := MoveOrphan(sourcePath, filepath.Join(sourcePath, "my-org", "gone"))
+	if err != nil {
+		t.Fatalf("MoveOrphan() error = %v", err)
+	}
+	if !strings.HasPrefix(filepath.Base(moved), "gone.") {
+		t.Errorf("MoveOrphan() moved to %s, want a new name next to the earlier one", moved)
+	}
+}
@@ -0,0 +1,24 @@
+package git_backup
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var pingClient = &http.Client{Timeout: 10 * time.Second}
+
+// Ping notifies an external monitor (e.g. a dead man's switch such as
+// healthchecks.io) by POSTing body to the given url.
+func Ping(url string, body string) error {
+	response, err := pingClient.Post(url, "text/plain", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s responded with %s", url, response.Status)
+	}
+	return nil
+}
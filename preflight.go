@@ -0,0 +1,26 @@
+package git_backup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CheckReachable verifies that the host behind rawURL answers HTTP requests
+// within the given timeout. Any HTTP response counts as reachable, since the
+// goal is to detect hosts that are down, not to verify credentials.
+func CheckReachable(rawURL string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %w", rawURL, err)
+	}
+	return response.Body.Close()
+}
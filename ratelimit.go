@@ -0,0 +1,104 @@
+package git_backup
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"golang.org/x/time/rate"
+)
+
+// DialFunc dials a network connection, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// NewRateLimiter returns a limiter that allows bytesPerSecond, with bursts
+// of up to a second's worth.
+func NewRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// RateLimitedDial wraps dial, so that all connections it makes share the
+// throughput of limiter, reading and writing combined.
+func RateLimitedDial(dial DialFunc, limiter *rate.Limiter) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return newRateLimitedConn(conn, limiter), nil
+	}
+}
+
+// rateLimitedConn waits for limiter before every read and write. The wait
+// is canceled when the connection is closed, which is how the http transport
+// cancels a request once its context, e.g. the repository timeout or a
+// second interrupt, is done. The dial context cannot be used, it only covers
+// establishing the connection.
+type rateLimitedConn struct {
+	net.Conn
+	reader  io.Reader
+	limiter *rate.Limiter
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newRateLimitedConn(conn net.Conn, limiter *rate.Limiter) *rateLimitedConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &rateLimitedConn{
+		Conn:    conn,
+		reader:  &rateLimitedReader{ctx: ctx, reader: conn, limiter: limiter},
+		limiter: limiter,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (c *rateLimitedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *rateLimitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := limitChunk(p[written:], c.limiter)
+		if err := c.limiter.WaitN(c.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *rateLimitedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// rateLimitedReader reads no faster than limiter allows, until ctx is done.
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(limitChunk(p, r.limiter))
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// limitChunk shortens p to the limiter's burst, WaitN fails for anything larger.
+func limitChunk(p []byte, limiter *rate.Limiter) []byte {
+	if burst := limiter.Burst(); len(p) > burst {
+		return p[:burst]
+	}
+	return p
+}
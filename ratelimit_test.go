@@ -0,0 +1,81 @@
+package git_backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeDial dials one end of a net.Pipe, and returns the other end on server.
+func pipeDial(server chan<- net.Conn) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, remote := net.Pipe()
+		server <- remote
+		return client, nil
+	}
+}
+
+func TestRateLimitedDialCapsThroughput(t *testing.T) {
+	const bytesPerSecond = 32 * 1024
+	// the first second's worth is a burst, the rest takes a second
+	payload := bytes.Repeat([]byte("x"), 2*bytesPerSecond)
+
+	server := make(chan net.Conn, 1)
+	dial := RateLimitedDial(pipeDial(server), NewRateLimiter(bytesPerSecond))
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	remote := <-server
+	go func() {
+		_, _ = remote.Write(payload)
+		_ = remote.Close()
+	}()
+
+	start := time.Now()
+	received, err := io.ReadAll(conn)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(payload) {
+		t.Fatalf("received %d bytes, want %d", len(received), len(payload))
+	}
+	if elapsed < 900*time.Millisecond {
+		t.Errorf("reading %d bytes at %d bytes/s took %s, want at least a second", len(payload), bytesPerSecond, elapsed)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("reading %d bytes at %d bytes/s took %s, far slower than the limit", len(payload), bytesPerSecond, elapsed)
+	}
+}
+
+func TestRateLimitedConnCloseCancelsWait(t *testing.T) {
+	server := make(chan net.Conn, 1)
+	// one byte per second, so the write blocks in the limiter
+	dial := RateLimitedDial(pipeDial(server), NewRateLimiter(1))
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := <-server
+	go func() {
+		_, _ = io.Copy(io.Discard, remote)
+	}()
+	time.AfterFunc(100*time.Millisecond, func() {
+		_ = conn.Close()
+	})
+
+	start := time.Now()
+	_, err = conn.Write([]byte("0123456789"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Write() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Write() returned after %s, closing the connection should stop the wait", elapsed)
+	}
+}
@@ -0,0 +1,102 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+)
+
+// Recording holds the repositories listed by each source during a run, so
+// the run can later be replayed without talking to the providers.
+type Recording struct {
+	Sources []*RecordedSource `json:"sources"`
+}
+
+// RecordedSource is a RepositorySource that replays a recorded listing.
+type RecordedSource struct {
+	Name         string                `json:"name"`
+	URL          string                `json:"url"`
+	Repositories []*RecordedRepository `json:"repositories"`
+}
+
+type RecordedRepository struct {
+	FullName string `json:"full_name"`
+	GitURL   string `json:"git_url"`
+	Archived bool   `json:"archived,omitempty"`
+	Fork     bool   `json:"fork,omitempty"`
+}
+
+// Add records the repositories listed by source. Credentials embedded in the
+// clone urls are removed.
+func (r *Recording) Add(source RepositorySource, repos []*Repository) {
+	recorded := &RecordedSource{
+		Name:         source.GetName(),
+		URL:          source.GetURL(),
+		Repositories: make([]*RecordedRepository, 0, len(repos)),
+	}
+	for _, repo := range repos {
+		gitUrl := repo.GitURL
+		gitUrl.User = nil
+		recorded.Repositories = append(recorded.Repositories, &RecordedRepository{
+			FullName: repo.FullName,
+			GitURL:   gitUrl.String(),
+			Archived: repo.Archived,
+			Fork:     repo.Fork,
+		})
+	}
+	r.Sources = append(r.Sources, recorded)
+}
+
+func (r *Recording) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	recording := &Recording{}
+	return recording, json.Unmarshal(data, recording)
+}
+
+func (r *Recording) GetSources() []RepositorySource {
+	sources := make([]RepositorySource, len(r.Sources))
+	for i, source := range r.Sources {
+		sources[i] = source
+	}
+	return sources
+}
+
+func (s *RecordedSource) GetName() string {
+	return s.Name
+}
+
+func (s *RecordedSource) GetURL() string {
+	return s.URL
+}
+
+func (s *RecordedSource) Test() error {
+	return nil
+}
+
+func (s *RecordedSource) ListRepositories() ([]*Repository, error) {
+	out := make([]*Repository, 0, len(s.Repositories))
+	for _, repo := range s.Repositories {
+		gitUrl, err := url.Parse(repo.GitURL)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, &Repository{
+			FullName: repo.FullName,
+			GitURL:   *gitUrl,
+			Archived: repo.Archived,
+			Fork:     repo.Fork,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// JSONReport writes the BackupResult as JSON to Path at the end of a run, for
+// dashboards that read files rather than receive webhooks.
+type JSONReport struct {
+	Path string
+}
+
+func (n *JSONReport) Notify(result BackupResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(n.Path, data)
+}
+
+// JUnitReport writes the BackupResult as a JUnit XML report to Path, so CI
+// systems such as Jenkins and GitLab show the run as a test report. Every
+// source is a test suite and every repository a test case, failed
+// repositories have a failure with their category as its type and deferred
+// and disabled repositories are skipped. The run
+// itself is an extra "git-backup" test case, which fails when the run had
+// errors or was interrupted, including errors outside of any repository.
+type JUnitReport struct {
+	Path string
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr,omitempty"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (n *JUnitReport) Notify(result BackupResult) error {
+	data, err := createJUnitReport(result)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(n.Path, data)
+}
+
+func createJUnitReport(result BackupResult) ([]byte, error) {
+	bySource := make(map[string]*junitTestSuite)
+	for _, status := range result.Statuses {
+		suite, ok := bySource[status.Source]
+		if !ok {
+			suite = &junitTestSuite{Name: status.Source}
+			bySource[status.Source] = suite
+		}
+		testCase := junitTestCase{
+			ClassName: status.Source,
+			Name:      status.Repository,
+			Time:      junitTime(status.Duration),
+			SystemOut: fmt.Sprintf("%s, %s on disk", status.Outcome, FormatSize(status.Size)),
+		}
+		if status.Failure != nil {
+			testCase.Failure = &junitFailure{Message: status.Failure.Error, Type: string(status.Failure.Category), Text: status.Failure.Error}
+			suite.Failures++
+		}
+		if status.Outcome == OutcomeDeferred {
+			testCase.Skipped = &junitSkipped{Message: "deferred, the backup size budget was used up"}
+			suite.Skipped++
+		}
+		if status.Outcome == OutcomeDisabled {
+			testCase.Skipped = &junitSkipped{Message: "disabled, it failed too many runs in a row"}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	run := junitTestCase{ClassName: "git-backup", Name: "git-backup", Time: junitTime(result.Duration), SystemOut: result.Summary}
+	if !result.Success() {
+		failureType := "errors"
+		if result.Interrupted {
+			failureType = "interrupted"
+		}
+		run.Failure = &junitFailure{Message: result.Summary, Type: failureType, Text: result.Summary}
+	}
+	report := junitTestSuites{Name: "git-backup", Time: junitTime(result.Duration)}
+	for _, source := range sources {
+		suite := bySource[source]
+		var duration time.Duration
+		for _, status := range result.Statuses {
+			if status.Source == source {
+				duration += status.Duration
+			}
+		}
+		suite.Time = junitTime(duration)
+		report.Suites = append(report.Suites, *suite)
+	}
+	runSuite := junitTestSuite{Name: "git-backup", Tests: 1, Time: run.Time, Cases: []junitTestCase{run}}
+	if run.Failure != nil {
+		runSuite.Failures = 1
+	}
+	report.Suites = append(report.Suites, runSuite)
+	for _, suite := range report.Suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// junitTime formats d in seconds, as JUnit reports do.
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
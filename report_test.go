@@ -0,0 +1,49 @@
+package git_backup
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestCreateJUnitReport(t *testing.T) {
+	failure := Failure{Repository: "my-org/b", Category: FailureAuth, Error: "authentication required"}
+	result := BackupResult{
+		Errors:   1,
+		Failures: []Failure{failure},
+		Summary:  "Backed up 2 repositories, encountered 1 errors",
+		Statuses: []RepositoryStatus{
+			{Repository: "my-org/a", Source: "GitHub", Outcome: OutcomeChanged},
+			{Repository: "my-org/b", Source: "GitHub", Outcome: OutcomeFailed, Failure: &failure},
+			{Repository: "my-org/c", Source: "GitHub", Outcome: OutcomeDeferred},
+			{Repository: "my-org/d", Source: "GitHub", Outcome: OutcomeDisabled},
+		},
+	}
+	data, err := createJUnitReport(result)
+	if err != nil {
+		t.Fatalf("createJUnitReport() error = %v", err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("the report cannot be parsed: %v\n%s", err, data)
+	}
+	// the GitHub suite and the suite of the run itself
+	if report.Tests != 5 || report.Failures != 2 || len(report.Suites) != 2 {
+		t.Fatalf("report has %d tests, %d failures in %d suites, want 5, 2 in 2:\n%s", report.Tests, report.Failures, len(report.Suites), data)
+	}
+	suite := report.Suites[0]
+	if suite.Name != "GitHub" || suite.Failures != 1 || suite.Skipped != 2 {
+		t.Errorf("suite %s has %d failures and %d skipped, want GitHub with 1 and 2", suite.Name, suite.Failures, suite.Skipped)
+	}
+	for _, testCase := range suite.Cases {
+		switch testCase.Name {
+		case "my-org/b":
+			if testCase.Failure == nil || testCase.Failure.Type != string(FailureAuth) {
+				t.Errorf("my-org/b failure = %+v, want type %s", testCase.Failure, FailureAuth)
+			}
+		case "my-org/c", "my-org/d":
+			if testCase.Skipped == nil || testCase.Failure != nil {
+				t.Errorf("%s = %+v, want it skipped", testCase.Name, testCase)
+			}
+		}
+	}
+}
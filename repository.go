@@ -1,25 +1,200 @@
 package git_backup
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 type RepositorySource interface {
 	GetName() string
+	GetURL() string
 	Test() error
 	ListRepositories() ([]*Repository, error)
 }
 
+// SettingsSource is implemented by repository sources that can export the
+// provider-side settings of a repository, such as branch protection rules
+// and webhooks, which are not part of the git data itself.
+type SettingsSource interface {
+	GetSettings(repo *Repository) (any, error)
+}
+
+// CanarySource is implemented by repository sources that have a canary
+// repository configured, which is backed up first as a quick end-to-end
+// check. abort reports whether the job should stop when the canary fails.
+type CanarySource interface {
+	GetCanary() (name string, abort bool)
+}
+
+// FilterSource is implemented by repository sources that have include or
+// exclude glob patterns configured, see FilterRepositories.
+type FilterSource interface {
+	GetFilter() (include, exclude []string)
+}
+
+// SkipSource is implemented by repository sources that configure whether
+// archived repositories and forks are skipped. A nil value leaves the
+// decision to the command line flags.
+type SkipSource interface {
+	GetSkip() (archived *bool, forks *bool)
+}
+
+// ValidatingSource is implemented by repository sources that can check
+// their configuration without contacting the provider.
+type ValidatingSource interface {
+	Validate() error
+}
+
+// CredentialHolder is implemented by repository sources that keep
+// credentials around and can drop them once they are no longer needed.
+type CredentialHolder interface {
+	ClearCredentials()
+}
+
 type Repository struct {
 	GitURL   url.URL
 	FullName string
+	// Size is the size in bytes as reported by the provider, or 0 when unknown.
+	Size int64
+	// Archived and Fork are reported by the provider, see SkipRepositories.
+	Archived bool
+	Fork     bool
+	// SSHKey configures authentication for ssh clone urls. When nil, or
+	// without a key path, the ssh agent is used.
+	SSHKey *SSHKey
+	// Auth authenticates https clone urls. Sources set it rather than
+	// embedding the token in GitURL, which ends up in logs and in the
+	// config of the clone. Credentials in GitURL are used when it is nil.
+	Auth transport.AuthMethod
+}
+
+// ClearCredentials removes the credentials of the repository.
+func (r *Repository) ClearCredentials() {
+	r.GitURL.User = nil
+	r.Auth = nil
+	if r.SSHKey != nil {
+		r.SSHKey.Passphrase = ""
+	}
+}
+
+// remoteURL returns the clone url without credentials, as stored in the
+// origin remote of the clone. The user name of ssh urls is kept, it selects
+// the account on the server rather than authenticating it.
+func (r *Repository) remoteURL() string {
+	remoteURL := r.GitURL
+	if remoteURL.Scheme == "ssh" && remoteURL.User != nil {
+		remoteURL.User = url.User(remoteURL.User.Username())
+	} else {
+		remoteURL.User = nil
+	}
+	return remoteURL.String()
+}
+
+// Matches reports whether nameOrURL refers to this repository, either by its
+// full name or by its clone url (ignoring credentials and a .git suffix).
+func (r *Repository) Matches(nameOrURL string) bool {
+	if strings.EqualFold(nameOrURL, r.FullName) {
+		return true
+	}
+	other, err := url.Parse(nameOrURL)
+	if err != nil || other.Host == "" {
+		return false
+	}
+	normalize := func(u url.URL) string {
+		return strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	}
+	return strings.EqualFold(other.Host, r.GitURL.Host) && strings.EqualFold(normalize(*other), normalize(r.GitURL))
+}
+
+// followDefaultBranch checks out the remote's current default branch when it
+// differs from the checked out one (e.g. after a master to main rename), so
+// worktree backups keep tracking the real default branch.
+func (r *Repository) followDefaultBranch(ctx context.Context, gitRepo *git.Repository, w *git.Worktree, auth transport.AuthMethod, progress io.Writer) error {
+	remote, err := gitRepo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return err
+	}
+	var defaultBranch plumbing.ReferenceName
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			defaultBranch = ref.Target()
+		}
+	}
+	head, err := gitRepo.Head()
+	if err != nil {
+		return err
+	}
+	if defaultBranch == "" || head.Name() == defaultBranch {
+		return nil
+	}
+
+	slog.Info("Default branch changed", "repo", r.FullName, "from", head.Name().Short(), "to", defaultBranch.Short())
+	err = gitRepo.FetchContext(ctx, &git.FetchOptions{
+		Auth:     auth,
+		Progress: progress,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	remoteBranch, err := gitRepo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, defaultBranch.Short()), true)
+	if err != nil {
+		return err
+	}
+	checkout := &git.CheckoutOptions{Branch: defaultBranch, Force: true}
+	if _, err := gitRepo.Reference(defaultBranch, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		checkout.Hash = remoteBranch.Hash()
+		checkout.Create = true
+	}
+	return w.Checkout(checkout)
+}
+
+// VerifyWorktree checks that the working tree of the non-bare backup at path
+// matches HEAD. When it has drifted, e.g. because an earlier pull was
+// interrupted, it is reset and cleaned. It reports whether drift was found.
+func VerifyWorktree(path string) (bool, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return false, err
+	}
+	w, err := gitRepo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	if status.IsClean() {
+		return false, nil
+	}
+	if err := w.Reset(&git.ResetOptions{Mode: git.HardReset}); err != nil {
+		return true, err
+	}
+	return true, w.Clean(&git.CleanOptions{Dir: true})
 }
 
 func isBare(repo *git.Repository) (bool, error) {
@@ -31,33 +206,251 @@ func isBare(repo *git.Repository) (bool, error) {
 	return config.Core.IsBare, nil
 }
 
-func (r *Repository) CloneInto(path string, bare bool) error {
-	var auth http.AuthMethod
-	if r.GitURL.User != nil {
-		password, _ := r.GitURL.User.Password()
-		auth = &http.BasicAuth{
-			Username: r.GitURL.User.Username(),
-			Password: password,
+// CloneIntoAtomic backs up the repository into a temporary directory next to
+// path and only replaces path once the backup succeeded. This way path always
+// holds either the previous or the new complete backup, never a partial one.
+func (r *Repository) CloneIntoAtomic(ctx context.Context, path string, opts CloneOptions) (bool, error) {
+	tempPath, err := os.MkdirTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tempPath)
+
+	if _, err := os.Stat(path); err == nil {
+		if err := copyDir(path, tempPath); err != nil {
+			return false, err
 		}
 	}
-	gitRepo, err := git.PlainClone(path, bare, &git.CloneOptions{
-		URL:      r.GitURL.String(),
-		Auth:     auth,
-		Progress: os.Stdout,
+	changed, err := r.CloneInto(ctx, tempPath, opts)
+	if err != nil {
+		return false, err
+	}
+
+	oldPath := tempPath + ".old"
+	if err := os.Rename(path, oldPath); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		// put the previous backup back in place
+		_ = os.Rename(oldPath, path)
+		return false, err
+	}
+	return changed, os.RemoveAll(oldPath)
+}
+
+// CloneOptions tune how CloneInto backs up a repository.
+type CloneOptions struct {
+	// Bare makes bare clones without checking out the main branch.
+	Bare bool
+	// MaxRefs is the number of remote refs above which a warning is logged.
+	// Zero disables the check.
+	MaxRefs int
+	// DefaultBranchOnly limits repositories with more than MaxRefs refs to
+	// their default branch, without tags.
+	DefaultBranchOnly bool
+	// SingleBranch, NoCheckout, Depth and Tags are passed on to go-git as is,
+	// see GitOptions.
+	SingleBranch bool
+	NoCheckout   bool
+	Depth        int
+	Tags         git.TagMode
+	// Retry decides which failures are retried, and when.
+	Retry RetryPolicy
+	// Timeout is how long a repository may take to be backed up. Zero means
+	// no limit. It is applied by the caller through the context.
+	Timeout time.Duration
+	// InsecureSkipHostKey disables host key verification for ssh urls.
+	InsecureSkipHostKey bool
+	// Prune removes branches and tags that were deleted upstream. It only
+	// applies to bare clones, working tree clones are never pruned.
+	Prune bool
+	// LFS also fetches the Git LFS objects of repositories that use LFS,
+	// which requires the git and git-lfs binaries.
+	LFS bool
+	// Progress receives go-git's progress output. It is discarded when nil.
+	Progress io.Writer
+}
+
+// CloneInto clones the repository into path, or updates it when path already
+// holds a backup. It reports whether any ref changed by comparing the ref
+// hashes before and after, rather than relying on go-git's up-to-date errors.
+func (r *Repository) CloneInto(ctx context.Context, path string, opts CloneOptions) (bool, error) {
+	before := refHashes(path)
+	err := r.cloneOrUpdate(ctx, path, opts)
+	for retry := 1; retry <= opts.Retry.MaxRetries && opts.Retry.IsTransient(err) && ctx.Err() == nil; retry++ {
+		delay := opts.Retry.Delay(retry)
+		slog.Warn("Retrying after a transient error", "repo", r.FullName, "delay", delay.Round(time.Second), "retry", retry, "max_retries", opts.Retry.MaxRetries, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+			err = r.cloneOrUpdate(ctx, path, opts)
+		}
+	}
+	if err == nil && opts.LFS {
+		err = r.fetchLFS(ctx, path, opts)
+	}
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		// go-git does not always wrap the context error
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	if err != nil {
+		return false, err
+	}
+	return !maps.Equal(before, refHashes(path)), nil
+}
+
+// refHashes returns the hash of every ref in the repository at path, or nil
+// when there is no repository yet.
+func refHashes(path string) map[plumbing.ReferenceName]plumbing.Hash {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil
+	}
+	refs, err := gitRepo.References()
+	if err != nil {
+		return nil
+	}
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name()] = ref.Hash()
+		}
+		return nil
 	})
+	return hashes
+}
+
+func (r *Repository) auth(opts CloneOptions) (transport.AuthMethod, error) {
+	if r.GitURL.Scheme == "ssh" {
+		return r.sshAuth(opts)
+	}
+	if r.Auth != nil {
+		return r.Auth, nil
+	}
+	if r.GitURL.User == nil {
+		return nil, nil
+	}
+	password, _ := r.GitURL.User.Password()
+	return &http.BasicAuth{
+		Username: r.GitURL.User.Username(),
+		Password: password,
+	}, nil
+}
+
+// limitedBranch checks the number of remote refs against opts.MaxRefs. It
+// returns the default branch when the repository exceeds the maximum and
+// should be limited to it, or an empty name otherwise.
+func (r *Repository) limitedBranch(ctx context.Context, auth transport.AuthMethod, opts CloneOptions) (plumbing.ReferenceName, error) {
+	if opts.MaxRefs <= 0 {
+		return "", nil
+	}
+	refs, err := r.listRemote(ctx, auth)
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if len(refs) <= opts.MaxRefs {
+		return "", nil
+	}
+	slog.Warn("Repository has more refs than the maximum", "repo", r.FullName, "refs", len(refs), "max_refs", opts.MaxRefs)
+	if !opts.DefaultBranchOnly {
+		return "", nil
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			slog.Info("Only backing up the default branch", "repo", r.FullName, "branch", ref.Target().Short())
+			return ref.Target(), nil
+		}
+	}
+	return "", nil
+}
+
+// listRemote lists the refs of the remote repository, like git ls-remote.
+func (r *Repository) listRemote(ctx context.Context, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{r.remoteURL()},
+	})
+	return remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+}
+
+// RemoteFingerprint lists the refs of the remote repository and returns a
+// hash of them. As long as the fingerprint is unchanged, nothing was pushed
+// to the repository and fetching it can be skipped.
+func (r *Repository) RemoteFingerprint(ctx context.Context, opts CloneOptions) (string, error) {
+	auth, err := r.auth(opts)
+	if err != nil {
+		return "", err
+	}
+	refs, err := r.listRemote(ctx, auth)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		lines = append(lines, ref.String())
+	}
+	sort.Strings(lines)
+	fingerprint := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(fingerprint[:]), nil
+}
+
+func (r *Repository) cloneOrUpdate(ctx context.Context, path string, opts CloneOptions) error {
+	auth, err := r.auth(opts)
+	if err != nil {
+		return err
+	}
+	branch, err := r.limitedBranch(ctx, auth, opts)
+	if err != nil {
+		return err
+	}
+	cloneOptions := &git.CloneOptions{
+		URL:          r.remoteURL(),
+		Auth:         auth,
+		Progress:     opts.Progress,
+		SingleBranch: opts.SingleBranch,
+		NoCheckout:   opts.NoCheckout,
+		Depth:        opts.Depth,
+		Tags:         opts.Tags,
+	}
+	fetchOptions := &git.FetchOptions{
+		Auth:     auth,
+		Progress: opts.Progress,
+		Depth:    opts.Depth,
+		Tags:     git.AllTags,
+		Force:    true,
+	}
+	if opts.Tags != git.InvalidTagMode {
+		fetchOptions.Tags = opts.Tags
+	}
+	if branch != "" {
+		cloneOptions.ReferenceName = branch
+		cloneOptions.SingleBranch = true
+		cloneOptions.Tags = git.NoTags
+		fetchOptions.RefSpecs = []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+%s:%s", branch, plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short()))),
+		}
+		fetchOptions.Tags = git.NoTags
+	}
+	gitRepo, err := git.PlainCloneContext(ctx, path, opts.Bare, cloneOptions)
 
 	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
 		// Pull instead of clone
 		if gitRepo, err = git.PlainOpen(path); err == nil {
+			err = r.resetRemoteURL(gitRepo)
+		}
+		if err == nil {
 			// we need to check whether it's a bare repo or not.
 			// if not we should pull, if it is then pull won't work
 			if isBare, bErr := isBare(gitRepo); bErr == nil && !isBare {
 				if w, wErr := gitRepo.Worktree(); wErr != nil {
 					err = wErr
-				} else {
-					err = w.Pull(&git.PullOptions{
+				} else if err = r.followDefaultBranch(ctx, gitRepo, w, auth, opts.Progress); err == nil {
+					err = w.PullContext(ctx, &git.PullOptions{
 						Auth:     auth,
-						Progress: os.Stdout,
+						Progress: opts.Progress,
+						Depth:    opts.Depth,
 					})
 				}
 			}
@@ -66,30 +459,73 @@ func (r *Repository) CloneInto(path string, bare bool) error {
 
 	switch {
 	case errors.Is(err, transport.ErrEmptyRemoteRepository):
-		log.Printf("%s is an empty repository", r.FullName)
+		slog.Info("Repository is empty", "repo", r.FullName)
 		//  Empty repo does not need backup
 		return nil
 	default:
 		return err
 	case errors.Is(err, git.NoErrAlreadyUpToDate):
-		log.Printf("No need to pull, %s is already up-to-date", r.FullName)
+		slog.Debug("No need to pull, already up-to-date", "repo", r.FullName)
 		// Already up to date on current branch, still need to refresh other branches
 		fallthrough
 	case err == nil:
 		// No errors, continue
-		err = gitRepo.Fetch(&git.FetchOptions{
-			Auth:     auth,
-			Progress: os.Stdout,
-			Tags:     git.AllTags,
-			Force:    true,
-		})
+		if opts.Prune {
+			if err := pruneOptions(gitRepo, fetchOptions); err != nil {
+				return err
+			}
+		}
+		return r.fetchAllRefs(ctx, gitRepo, fetchOptions)
 	}
+}
 
-	switch err {
-	case git.NoErrAlreadyUpToDate:
-		log.Printf("No need to fetch, %s is already up-to-date", r.FullName)
+// resetRemoteURL points the origin remote of gitRepo at the current clone
+// url. Backups made before the sources passed tokens through Repository.Auth
+// have the token embedded in their origin url, which this removes, and
+// rewritten or moved repositories are fetched from their new url.
+func (r *Repository) resetRemoteURL(gitRepo *git.Repository) error {
+	cfg, err := gitRepo.Config()
+	if err != nil {
+		return err
+	}
+	remote, ok := cfg.Remotes[git.DefaultRemoteName]
+	remoteURL := r.remoteURL()
+	if !ok || slices.Equal(remote.URLs, []string{remoteURL}) {
 		return nil
-	default:
+	}
+	remote.URLs = []string{remoteURL}
+	return gitRepo.SetConfig(cfg)
+}
+
+// pruneOptions makes fetchOptions prune refs deleted upstream, when gitRepo is
+// a bare clone. go-git only prunes refs matching the fetch refspecs, so the
+// remote's refspecs and the tags refspec are spelled out.
+func pruneOptions(gitRepo *git.Repository, fetchOptions *git.FetchOptions) error {
+	if bare, err := isBare(gitRepo); err != nil || !bare {
 		return err
 	}
+	if len(fetchOptions.RefSpecs) == 0 {
+		remote, err := gitRepo.Remote(git.DefaultRemoteName)
+		if err != nil {
+			return err
+		}
+		fetchOptions.RefSpecs = append(fetchOptions.RefSpecs, remote.Config().Fetch...)
+		if fetchOptions.Tags == git.AllTags {
+			fetchOptions.RefSpecs = append(fetchOptions.RefSpecs, "+refs/tags/*:refs/tags/*")
+		}
+	}
+	fetchOptions.Prune = true
+	return nil
+}
+
+// fetchAllRefs refreshes all branches and tags, which a pull does not do.
+// Branches and tags are fetched together, so any failure means the backup is
+// incomplete and is returned; only being up-to-date is not an error.
+func (r *Repository) fetchAllRefs(ctx context.Context, gitRepo *git.Repository, fetchOptions *git.FetchOptions) error {
+	err := gitRepo.FetchContext(ctx, fetchOptions)
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		slog.Debug("No need to fetch, already up-to-date", "repo", r.FullName)
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,109 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// RestoredRef is the outcome of pushing one ref of a backup.
+type RestoredRef struct {
+	Name     plumbing.ReferenceName
+	Hash     plumbing.Hash
+	UpToDate bool
+}
+
+// RestoreRepository pushes the branches and tags of the backup at path to
+// remoteURL, which is expected to be a new, empty repository. Branches are
+// taken from the remote-tracking refs of the backup, see branchHeads, so bare
+// and working tree backups restore the same way. Authentication works as it
+// does for cloning: credentials in the url, or an ssh key (or agent) for ssh
+// urls.
+func RestoreRepository(ctx context.Context, path string, remoteURL string, sshKey *SSHKey, opts CloneOptions) ([]RestoredRef, error) {
+	gitURL, err := parseGitURL(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	// a shallow backup lacks the older history, which the new remote would reject or silently miss
+	if shallow, err := gitRepo.Storer.Shallow(); err != nil {
+		return nil, err
+	} else if len(shallow) > 0 {
+		return nil, fmt.Errorf("%s is a shallow backup (-backup.depth), which cannot be restored", path)
+	}
+	target := &Repository{GitURL: *gitURL, FullName: remoteURL, SSHKey: sshKey}
+	return pushBackup(ctx, gitRepo, path, target, opts)
+}
+
+// pushBackup force pushes the branches and tags of the backup at path to
+// target, see RestoreRepository.
+func pushBackup(ctx context.Context, gitRepo *git.Repository, path string, target *Repository, opts CloneOptions) ([]RestoredRef, error) {
+	auth, err := target.auth(opts)
+	if err != nil {
+		return nil, err
+	}
+	heads, err := branchHeads(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// an anonymous remote keeps the target, and its credentials, out of the backup's config
+	remote, err := gitRepo.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{target.GitURL.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[plumbing.ReferenceName]plumbing.Hash)
+	remoteRefs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil, err
+	}
+	for _, ref := range remoteRefs {
+		existing[ref.Name()] = ref.Hash()
+	}
+
+	refSpecs := make([]config.RefSpec, 0, len(heads)+1)
+	restored := make([]RestoredRef, 0, len(heads))
+	for branch, ref := range heads {
+		name := plumbing.NewBranchReferenceName(branch)
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("+%s:%s", ref.Name(), name)))
+		restored = append(restored, RestoredRef{Name: name, Hash: ref.Hash(), UpToDate: existing[name] == ref.Hash()})
+	}
+	tags, err := gitRepo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		restored = append(restored, RestoredRef{Name: ref.Name(), Hash: ref.Hash(), UpToDate: existing[ref.Name()] == ref.Hash()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	refSpecs = append(refSpecs, "+refs/tags/*:refs/tags/*")
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].Name < restored[j].Name
+	})
+
+	err = remote.PushContext(ctx, &git.PushOptions{
+		RemoteName: "anonymous",
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+		Progress:   opts.Progress,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, err
+	}
+	return restored, nil
+}
@@ -0,0 +1,277 @@
+package git_backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/klauspost/compress/zstd"
+)
+
+// branchHeads returns the ref holding each branch of the backup at path.
+// Clones keep branches as remote-tracking refs, local branches are only used
+// when there is no remote-tracking counterpart.
+func branchHeads(path string) (map[string]*plumbing.Reference, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := gitRepo.References()
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*plumbing.Reference, 0)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		all = append(all, ref)
+		return nil
+	})
+	return selectBranchHeads(all), err
+}
+
+// selectBranchHeads picks the ref holding each branch from refs, see
+// branchHeads.
+func selectBranchHeads(refs []*plumbing.Reference) map[string]*plumbing.Reference {
+	remotePrefix := "refs/remotes/" + git.DefaultRemoteName + "/"
+	heads := make(map[string]*plumbing.Reference)
+	local := make(map[string]*plumbing.Reference)
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		if name := ref.Name().String(); strings.HasPrefix(name, remotePrefix) {
+			heads[strings.TrimPrefix(name, remotePrefix)] = ref
+		} else if ref.Name().IsBranch() {
+			local[ref.Name().Short()] = ref
+		}
+	}
+	for branch, ref := range local {
+		if _, ok := heads[branch]; !ok {
+			heads[branch] = ref
+		}
+	}
+	return heads
+}
+
+// archivedRefs are the refs found in one git directory of an archive.
+type archivedRefs struct {
+	loose  map[plumbing.ReferenceName]plumbing.Hash
+	packed map[plumbing.ReferenceName]plumbing.Hash
+}
+
+// archiveBranchHeads reads the branch heads, see branchHeads, of the backup
+// archived at path by ArchiveRepository without extracting it. It also
+// returns the folder the archive extracts into.
+func archiveBranchHeads(path string) (map[string]*plumbing.Reference, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	var reader io.Reader
+	switch {
+	case strings.HasSuffix(path, ArchiveTarGz.Extension()):
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, "", err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case strings.HasSuffix(path, ArchiveTarZst.Extension()):
+		zstdReader, err := zstd.NewReader(file)
+		if err != nil {
+			return nil, "", err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, "", fmt.Errorf("%s is not an archive made by git-backup", path)
+	}
+
+	// a working tree may have a refs folder of its own, only .git counts then
+	var folder string
+	hasGitDir := false
+	gitDirs := map[string]*archivedRefs{"": newArchivedRefs(), ".git/": newArchivedRefs()}
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		top, name, _ := strings.Cut(header.Name, "/")
+		folder = top
+		gitDir := ""
+		if strings.HasPrefix(name, ".git/") {
+			gitDir, name = ".git/", strings.TrimPrefix(name, ".git/")
+			hasGitDir = true
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		refs := gitDirs[gitDir]
+		if name == "packed-refs" {
+			scanner := bufio.NewScanner(archive)
+			for scanner.Scan() {
+				hash, refName, ok := strings.Cut(scanner.Text(), " ")
+				if ok && plumbing.IsHash(hash) {
+					refs.packed[plumbing.ReferenceName(refName)] = plumbing.NewHash(hash)
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, "", err
+			}
+		} else if strings.HasPrefix(name, "refs/") {
+			data, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, "", err
+			}
+			// symbolic refs such as refs/remotes/origin/HEAD are no hashes
+			if hash := strings.TrimSpace(string(data)); plumbing.IsHash(hash) {
+				refs.loose[plumbing.ReferenceName(name)] = plumbing.NewHash(hash)
+			}
+		}
+	}
+
+	refs := gitDirs[""]
+	if hasGitDir {
+		refs = gitDirs[".git/"]
+	}
+	// loose refs are newer than their packed counterparts
+	for name, hash := range refs.packed {
+		if _, ok := refs.loose[name]; !ok {
+			refs.loose[name] = hash
+		}
+	}
+	all := make([]*plumbing.Reference, 0, len(refs.loose))
+	for name, hash := range refs.loose {
+		all = append(all, plumbing.NewHashReference(name, hash))
+	}
+	return selectBranchHeads(all), folder, nil
+}
+
+func newArchivedRefs() *archivedRefs {
+	return &archivedRefs{loose: make(map[plumbing.ReferenceName]plumbing.Hash), packed: make(map[plumbing.ReferenceName]plumbing.Hash)}
+}
+
+// restoreSource finds what a repository backed up into path can be restored
+// from: the folder itself, or else the newest snapshot or archive of it, and
+// reports whether that is an archive. The folder of this run is missing when
+// it failed as a snapshot, or was removed by -backup.archive-remove. It
+// returns an empty string when there is nothing.
+func restoreSource(path string) (string, bool) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path, false
+	}
+	// snapshots and their archives are kept in the repository's folder,
+	// the archives of a flat backup next to its folder
+	repoPath, folder := path, filepath.Dir(path)
+	if snapshotRepoPath, _, ok := parseSnapshotPath(path); ok {
+		repoPath, folder = snapshotRepoPath, snapshotRepoPath
+	}
+	var newest archiveCopy
+	isArchive := false
+	consider := func(candidate string, t time.Time, archive bool) {
+		if newest.path == "" || t.After(newest.time) {
+			newest, isArchive = archiveCopy{path: candidate, time: t}, archive
+		}
+	}
+	for _, format := range []ArchiveFormat{ArchiveTarGz, ArchiveTarZst} {
+		if info, err := os.Stat(path + format.Extension()); err == nil {
+			consider(path+format.Extension(), info.ModTime(), true)
+		}
+	}
+	entries, _ := os.ReadDir(folder)
+	for _, entry := range entries {
+		candidate := filepath.Join(folder, entry.Name())
+		if entry.IsDir() {
+			if snapshotRepoPath, t, ok := parseSnapshotPath(candidate); ok && snapshotRepoPath == repoPath {
+				consider(candidate, t, false)
+			}
+		} else if archivedRepoPath, t, ok := parseArchivePath(candidate); ok && archivedRepoPath == repoPath {
+			consider(candidate, t, true)
+		}
+	}
+	return newest.path, isArchive
+}
+
+// WriteRestoreDoc writes a RESTORE.md into sourcePath that lists the backed up
+// repositories, the commit of each branch and the command to restore them.
+// layout is the one the repositories were backed up with. Repositories are
+// documented from whatever of their backup is on disk, see restoreSource, so
+// one that failed this run is still listed with its previous backup.
+func WriteRestoreDoc(sourcePath string, sourceName string, repos []*Repository, layout BackupLayout) error {
+	var doc strings.Builder
+	fmt.Fprintf(&doc, "# Restoring %s\n\n", sourceName)
+	fmt.Fprintf(&doc, "Generated by git-backup at %s.\n\n", time.Now().Format(time.RFC3339))
+	doc.WriteString("Each repository is restored by pushing its branches and tags to a new, empty remote with the command listed below it. Archives are extracted into a restore folder first.\n")
+
+	sorted := make([]*Repository, len(repos))
+	copy(sorted, repos)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FullName < sorted[j].FullName
+	})
+	for i, repo := range sorted {
+		// jobs sharing a folder may list the same repository
+		if i > 0 && sorted[i-1].FullName == repo.FullName {
+			continue
+		}
+		path, isArchive := restoreSource(layout(sourcePath, repo))
+		if path == "" {
+			continue
+		}
+		relPath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		var heads map[string]*plumbing.Reference
+		var extract, gitPath string
+		if isArchive {
+			var folder string
+			if heads, folder, err = archiveBranchHeads(path); err != nil {
+				return fmt.Errorf("read %s: %w", path, err)
+			}
+			tarFlags := "-xzf"
+			if strings.HasSuffix(path, ArchiveTarZst.Extension()) {
+				tarFlags = "--zstd -xf"
+			}
+			extract = fmt.Sprintf("mkdir -p restore && tar %s '%s' -C restore\n", tarFlags, filepath.ToSlash(relPath))
+			gitPath = "restore/" + folder
+		} else if heads, err = branchHeads(path); err != nil {
+			// empty repositories have nothing to restore
+			continue
+		} else {
+			gitPath = filepath.ToSlash(relPath)
+		}
+		if len(heads) == 0 {
+			continue
+		}
+		branches := make([]string, 0, len(heads))
+		for branch := range heads {
+			branches = append(branches, branch)
+		}
+		sort.Strings(branches)
+
+		fmt.Fprintf(&doc, "\n## %s\n\n", repo.FullName)
+		fmt.Fprintf(&doc, "Backed up in `%s`.\n\n", filepath.ToSlash(relPath))
+		doc.WriteString("| Branch | Commit |\n|--------|--------|\n")
+		refSpecs := make([]string, 0, len(branches)+1)
+		for _, branch := range branches {
+			fmt.Fprintf(&doc, "| `%s` | `%s` |\n", branch, heads[branch].Hash())
+			refSpecs = append(refSpecs, fmt.Sprintf("'%s:refs/heads/%s'", heads[branch].Name(), branch))
+		}
+		refSpecs = append(refSpecs, "'refs/tags/*:refs/tags/*'")
+		fmt.Fprintf(&doc, "\n```bash\n%sgit -C '%s' push <new-remote-url> %s\n```\n", extract, gitPath, strings.Join(refSpecs, " "))
+	}
+
+	return os.WriteFile(filepath.Join(sourcePath, "RESTORE.md"), []byte(doc.String()), 0644)
+}
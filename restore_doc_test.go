@@ -0,0 +1,84 @@
+package git_backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveBranchHeads(t *testing.T) {
+	path, _ := newTestRepository(t, map[string]string{
+		// a working tree file that looks like a ref must not be read as one
+		"refs/heads/decoy": strings.Repeat("1", 40),
+	})
+	packed := strings.Repeat("2", 40)
+	if err := os.WriteFile(filepath.Join(path, ".git", "packed-refs"), []byte("# pack-refs with: peeled fully-peeled sorted\n"+packed+" refs/heads/packed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := branchHeads(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []ArchiveFormat{ArchiveTarGz, ArchiveTarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "repo"+format.Extension())
+			if err := ArchiveRepository(path, archivePath, format, 0); err != nil {
+				t.Fatal(err)
+			}
+			heads, folder, err := archiveBranchHeads(archivePath)
+			if err != nil {
+				t.Fatalf("archiveBranchHeads() error = %v", err)
+			}
+			if folder != filepath.Base(path) {
+				t.Errorf("folder = %q, want %q", folder, filepath.Base(path))
+			}
+			if len(heads) != len(want) {
+				t.Fatalf("archiveBranchHeads() = %v, want %v", heads, want)
+			}
+			for branch, ref := range want {
+				if heads[branch] == nil || heads[branch].Hash() != ref.Hash() {
+					t.Errorf("branch %s = %v, want %s", branch, heads[branch], ref.Hash())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRestoreDoc(t *testing.T) {
+	sourcePath := t.TempDir()
+	path, commit := newTestRepository(t, map[string]string{"README.md": "# repo\n"})
+	if err := os.MkdirAll(filepath.Join(sourcePath, "org"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// archived with -backup.archive-remove, only the archive is left
+	if err := ArchiveRepository(path, filepath.Join(sourcePath, "org", "archived.tar.zst"), ArchiveTarZst, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDir(path, filepath.Join(sourcePath, "org", "folder")); err != nil {
+		t.Fatal(err)
+	}
+	repos := []*Repository{{FullName: "org/folder"}, {FullName: "org/archived"}, {FullName: "org/missing"}}
+	if err := WriteRestoreDoc(sourcePath, "GitHub", repos, FlatLayout); err != nil {
+		t.Fatalf("WriteRestoreDoc() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(sourcePath, "RESTORE.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(data)
+	for _, want := range []string{
+		"## org/archived",
+		"tar --zstd -xf 'org/archived.tar.zst' -C restore\ngit -C 'restore/" + filepath.Base(path) + "' push <new-remote-url> 'refs/heads/master:refs/heads/master'",
+		"## org/folder",
+		"git -C 'org/folder' push <new-remote-url> 'refs/heads/master:refs/heads/master'",
+		"`" + commit.String() + "`",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("RESTORE.md does not contain %q:\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "org/missing") {
+		t.Errorf("RESTORE.md lists a repository without a backup:\n%s", doc)
+	}
+}
@@ -0,0 +1,133 @@
+package git_backup
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveTimeFormat is the timestamp in the name of archives and snapshots
+// kept under a retention policy.
+const archiveTimeFormat = "20060102T150405Z"
+
+// RetentionPolicy decides which archives and snapshots PruneBackups removes.
+type RetentionPolicy struct {
+	// Count is the number of archives and of snapshots kept per repository.
+	// Zero keeps all.
+	Count int
+	// MaxAge removes archives and snapshots older than this. Zero keeps all.
+	MaxAge time.Duration
+	// DryRun only reports which archives and snapshots would be removed.
+	DryRun bool
+}
+
+// Enabled reports whether the policy removes anything at all.
+func (p RetentionPolicy) Enabled() bool {
+	return p.Count > 0 || p.MaxAge > 0
+}
+
+// TimestampedArchivePath is the archive path for the backup folder at path,
+// made at time t, as recognized by PruneBackups.
+func TimestampedArchivePath(path string, format ArchiveFormat, t time.Time) string {
+	return path + "-" + t.UTC().Format(archiveTimeFormat) + format.Extension()
+}
+
+type archiveCopy struct {
+	path string
+	time time.Time
+}
+
+// PruneBackups removes the timestamped archives and the snapshot folders made
+// by SnapshotLayout under root that fall outside the policy, and returns their
+// paths. Archives and snapshots are counted separately. The newest of each for
+// a repository is always kept, regardless of its age.
+func PruneBackups(root string, policy RetentionPolicy) ([]string, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+	archives := make(map[string][]archiveCopy)
+	snapshots := make(map[string][]archiveCopy)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path != root {
+			if repoPath, t, ok := parseSnapshotPath(path); ok {
+				snapshots[repoPath] = append(snapshots[repoPath], archiveCopy{path: path, time: t})
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if repoPath, t, ok := parseArchivePath(path); ok {
+			archives[repoPath] = append(archives[repoPath], archiveCopy{path: path, time: t})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	pruned := make([]string, 0)
+	for _, copies := range []map[string][]archiveCopy{archives, snapshots} {
+		if err := pruneCopies(copies, policy, &pruned); err != nil {
+			return pruned, err
+		}
+	}
+	sort.Strings(pruned)
+	return pruned, nil
+}
+
+// pruneCopies removes the copies of each repository that fall outside the
+// policy, newest first, and adds their paths to pruned.
+func pruneCopies(copies map[string][]archiveCopy, policy RetentionPolicy, pruned *[]string) error {
+	now := time.Now()
+	for _, repoCopies := range copies {
+		sort.Slice(repoCopies, func(i, j int) bool {
+			return repoCopies[i].time.After(repoCopies[j].time)
+		})
+		for i, backup := range repoCopies[1:] {
+			tooMany := policy.Count > 0 && i+1 >= policy.Count
+			tooOld := policy.MaxAge > 0 && now.Sub(backup.time) > policy.MaxAge
+			if !tooMany && !tooOld {
+				continue
+			}
+			if !policy.DryRun {
+				// snapshots are folders, archives single files
+				if err := os.RemoveAll(backup.path); err != nil {
+					return err
+				}
+			}
+			*pruned = append(*pruned, backup.path)
+		}
+	}
+	return nil
+}
+
+// parseArchivePath splits a path made by TimestampedArchivePath, or an
+// archived snapshot, into the backup folder path and the time of the archive.
+func parseArchivePath(path string) (string, time.Time, bool) {
+	for _, format := range []ArchiveFormat{ArchiveTarGz, ArchiveTarZst} {
+		trimmed, found := strings.CutSuffix(path, format.Extension())
+		if !found {
+			continue
+		}
+		if repoPath, t, ok := parseSnapshotPath(trimmed); ok {
+			return repoPath, t, true
+		}
+		separator := strings.LastIndex(trimmed, "-")
+		if separator < 0 {
+			return "", time.Time{}, false
+		}
+		t, err := time.Parse(archiveTimeFormat, trimmed[separator+1:])
+		if err != nil {
+			return "", time.Time{}, false
+		}
+		return trimmed[:separator], t, true
+	}
+	return "", time.Time{}, false
+}
@@ -0,0 +1,115 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// RetryPolicy decides whether a failed backup of a repository is retried and
+// how long to wait before the next attempt.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, it doubles for every
+	// following retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  2 * time.Second,
+	MaxDelay:   time.Minute,
+}
+
+// permanentErrors are never retried, trying again won't make them go away.
+var permanentErrors = []error{
+	transport.ErrEmptyRemoteRepository,
+	transport.ErrRepositoryNotFound,
+	transport.ErrAuthenticationRequired,
+	transport.ErrAuthorizationFailed,
+	transport.ErrInvalidAuthMethod,
+	ErrLFSQuota,
+}
+
+// transientMessages catch network errors that go-git reports without wrapping.
+var transientMessages = []string{
+	"connection reset by peer",
+	"broken pipe",
+	"unexpected EOF",
+	"TLS handshake timeout",
+	"i/o timeout",
+}
+
+// IsTransient reports whether err is likely caused by a temporary network or
+// server problem, so that retrying may succeed.
+func (p RetryPolicy) IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	// a timed out or cancelled repository has no time left to retry in
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) {
+			status := httpErr.StatusCode()
+			return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+		}
+	}
+
+	message := err.Error()
+	for _, transient := range transientMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns how long to wait before the given retry, starting at 1. The
+// delay grows exponentially and is randomized between half and the full
+// delay, so repositories that failed together don't retry together.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
@@ -0,0 +1,80 @@
+package git_backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestRetryPolicyIsTransient(t *testing.T) {
+	status := func(code int) error {
+		return githttp.NewErr(&http.Response{StatusCode: code, Status: http.StatusText(code)})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error", err: nil, want: false},
+		{name: "connection reset", err: fmt.Errorf("fetch: %w", syscall.ECONNRESET), want: true},
+		{name: "unwrapped connection reset", err: errors.New("read tcp 10.0.0.1:443: connection reset by peer"), want: true},
+		{name: "eof", err: io.EOF, want: true},
+		{name: "unexpected eof during the pack", err: fmt.Errorf("reading pack: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "internal server error", err: status(http.StatusInternalServerError), want: true},
+		{name: "bad gateway", err: status(http.StatusBadGateway), want: true},
+		{name: "too many requests", err: status(http.StatusTooManyRequests), want: true},
+		{name: "bad request", err: status(http.StatusBadRequest), want: false},
+		{name: "authentication required", err: transport.ErrAuthenticationRequired, want: false},
+		{name: "unauthorized response", err: status(http.StatusUnauthorized), want: false},
+		{name: "empty remote repository", err: transport.ErrEmptyRemoteRepository, want: false},
+		{name: "lfs quota", err: fmt.Errorf("%w: This repository is over its data quota", ErrLFSQuota), want: false},
+		// the permanent error wins over the eof it was wrapped with
+		{name: "authentication required with eof", err: errors.Join(io.EOF, transport.ErrAuthenticationRequired), want: false},
+		{name: "deadline", err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), want: false},
+		{name: "anything else", err: errors.New("object not found"), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DefaultRetryPolicy.IsTransient(test.err); got != test.want {
+				t.Errorf("IsTransient(%v) = %t, want %t", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		retry int
+		delay time.Duration
+	}{
+		{retry: 1, delay: time.Second},
+		{retry: 2, delay: 2 * time.Second},
+		{retry: 3, delay: 4 * time.Second},
+		{retry: 4, delay: 8 * time.Second},
+		// capped by MaxDelay
+		{retry: 5, delay: 10 * time.Second},
+		{retry: 50, delay: 10 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.retry), func(t *testing.T) {
+			// the jitter keeps every delay between half and the full delay
+			for i := 0; i < 100; i++ {
+				if got := policy.Delay(test.retry); got < test.delay/2 || got > test.delay {
+					t.Fatalf("Delay(%d) = %s, want between %s and %s", test.retry, got, test.delay/2, test.delay)
+				}
+			}
+		})
+	}
+	if got := (RetryPolicy{}).Delay(1); got != 0 {
+		t.Errorf("Delay(1) without a base delay = %s, want 0", got)
+	}
+}
@@ -0,0 +1,69 @@
+package git_backup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// URLRewrite rewrites clone urls before cloning, similar to git's
+// url.<base>.insteadOf. Either Prefix or Pattern must be set.
+type URLRewrite struct {
+	// Prefix is replaced by Replace when a clone url starts with it.
+	Prefix string `yaml:"prefix,omitempty"`
+	// Pattern is a regular expression, Replace may refer to its groups as $1.
+	Pattern string `yaml:"pattern,omitempty"`
+	Replace string `yaml:"replace"`
+	pattern *regexp.Regexp
+}
+
+func (r *URLRewrite) compile() error {
+	if (r.Prefix == "") == (r.Pattern == "") {
+		return fmt.Errorf("url rewrite needs exactly one of prefix or pattern")
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid url rewrite pattern %q: %w", r.Pattern, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+func (r *URLRewrite) apply(rawURL string) (string, bool) {
+	if r.pattern != nil {
+		if !r.pattern.MatchString(rawURL) {
+			return rawURL, false
+		}
+		return r.pattern.ReplaceAllString(rawURL, r.Replace), true
+	}
+	if !strings.HasPrefix(rawURL, r.Prefix) {
+		return rawURL, false
+	}
+	return r.Replace + strings.TrimPrefix(rawURL, r.Prefix), true
+}
+
+// RewriteURL applies the first matching rewrite rule to the clone url of repo.
+// Credentials embedded in the url are kept.
+func (c *Config) RewriteURL(repo *Repository) error {
+	withoutUser := repo.GitURL
+	withoutUser.User = nil
+	for _, rewrite := range c.RewriteURLs {
+		rewritten, ok := rewrite.apply(withoutUser.String())
+		if !ok {
+			continue
+		}
+		gitUrl, err := url.Parse(rewritten)
+		if err != nil {
+			return err
+		}
+		gitUrl.User = repo.GitURL.User
+		slog.Debug("Rewrote clone url", "repo", repo.FullName, "url", rewritten)
+		repo.GitURL = *gitUrl
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package git_backup
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		valid bool
+	}{
+		{value: "", want: 0, valid: true},
+		{value: "1024", want: 1024, valid: true},
+		{value: "500MB", want: 500 << 20, valid: true},
+		{value: " 10 gb ", want: 10 << 30, valid: true},
+		{value: "1.5KB", want: 1536, valid: true},
+		{value: "-1GB"},
+		{value: "tenGB"},
+		{value: "NaN"},
+		{value: "NaNGB"},
+		{value: "Inf"},
+		{value: "+InfMB"},
+		{value: "-Inf"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseSize(test.value)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("ParseSize(%q) = %d, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("ParseSize(%q) = %d, %v, want %d", test.value, got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package git_backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SlackNotifier posts the result of a backup run to a Slack incoming webhook.
+// Discord accepts the same messages on its Slack compatible endpoint
+// (the webhook url with /slack appended).
+type SlackNotifier struct {
+	WebhookURL string
+	// MaxFailures is the number of failed repositories listed in the
+	// message, the count of each category is always included. Zero lists
+	// all of them.
+	MaxFailures int
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (n *SlackNotifier) Notify(result BackupResult) error {
+	return postJSON(n.WebhookURL, createSlackMessage(result, n.MaxFailures))
+}
+
+func createSlackMessage(result BackupResult, maxFailures int) slackMessage {
+	var text strings.Builder
+	if result.Interrupted {
+		text.WriteString(":warning: git-backup was interrupted\n")
+	} else if result.Success() {
+		text.WriteString(":white_check_mark: git-backup succeeded\n")
+	} else {
+		text.WriteString(":x: git-backup failed\n")
+	}
+	text.WriteString(result.Summary)
+	fmt.Fprintf(&text, "\nTotal size: %s", result.TotalSize())
+	for _, source := range sourceSizeLines(result) {
+		fmt.Fprintf(&text, "\n%s", source)
+	}
+	if len(result.Failures) > 0 {
+		fmt.Fprintf(&text, "\n```\n%s```", FailureSample(result.Failures, maxFailures))
+	}
+	return slackMessage{Text: text.String()}
+}
+
+// sourceSizeLines lists the size of each source, sorted by source name.
+func sourceSizeLines(result BackupResult) []string {
+	sources := make([]string, 0, len(result.SourceBytes))
+	for source := range result.SourceBytes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	lines := make([]string, len(sources))
+	for i, source := range sources {
+		lines[i] = fmt.Sprintf("%s: %s", source, FormatSize(result.SourceBytes[source]))
+	}
+	return lines
+}
@@ -0,0 +1,72 @@
+package git_backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupLayout computes the folder a repository of a source is backed up
+// into, given the source's folder.
+type BackupLayout func(sourcePath string, repo *Repository) string
+
+// FlatLayout backs up every repository into the same folder on each run,
+// <source>/<full name>.
+func FlatLayout(sourcePath string, repo *Repository) string {
+	return filepath.Join(sourcePath, repo.FullName)
+}
+
+// SnapshotLayout backs up every run into a new folder named after t,
+// <source>/<full name>/<timestamp>, so earlier runs stay intact until
+// PruneBackups removes them. The timestamp has no colons, which Windows
+// does not allow in file names.
+func SnapshotLayout(t time.Time) BackupLayout {
+	name := t.UTC().Format(archiveTimeFormat)
+	return func(sourcePath string, repo *Repository) string {
+		return filepath.Join(sourcePath, repo.FullName, name)
+	}
+}
+
+// SeedSnapshot fills the empty snapshot folder at path with the newest
+// earlier snapshot next to it, so the backup only needs to fetch what
+// changed since. Git objects are never modified once written, so they are
+// hard linked where possible instead of copied. It returns the snapshot that
+// was used, or an empty string when there is none.
+func SeedSnapshot(path string) (string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	var latestTime time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == filepath.Base(path) {
+			continue
+		}
+		t, err := time.Parse(archiveTimeFormat, entry.Name())
+		if err == nil && t.After(latestTime) {
+			latest, latestTime = filepath.Join(filepath.Dir(path), entry.Name()), t
+		}
+	}
+	if latest == "" {
+		return "", nil
+	}
+	objects := "objects"
+	if _, err := os.Stat(filepath.Join(latest, ".git")); err == nil {
+		objects = filepath.Join(".git", "objects")
+	}
+	return latest, copyTree(latest, path, func(rel string) bool {
+		return strings.HasPrefix(rel, objects+string(filepath.Separator))
+	})
+}
+
+// parseSnapshotPath splits a path made by SnapshotLayout into the
+// repository folder and the time of the snapshot.
+func parseSnapshotPath(path string) (string, time.Time, bool) {
+	t, err := time.Parse(archiveTimeFormat, filepath.Base(path))
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return filepath.Dir(path), t, true
+}
@@ -0,0 +1,83 @@
+package git_backup
+
+import (
+	"fmt"
+	"time"
+)
+
+// SourceOptions are the backup options a job can override. They are inlined
+// into the github, gitlab and gitea jobs. Unset options fall back to the
+// clone_options section and then to the command line flags.
+type SourceOptions struct {
+	BareClone *bool `yaml:"bare_clone,omitempty"`
+	Depth     *int  `yaml:"depth,omitempty"`
+	LFS       *bool `yaml:"lfs,omitempty"`
+	Prune     *bool `yaml:"prune,omitempty"`
+	// MaxRetries, RetryBaseDelay and RepoTimeout override -backup.max-retries,
+	// the delay before the first retry and -backup.repo-timeout, for sources
+	// that are less reliable than others.
+	MaxRetries     *int           `yaml:"max_retries,omitempty"`
+	RetryBaseDelay *time.Duration `yaml:"retry_base_delay,omitempty"`
+	RepoTimeout    *time.Duration `yaml:"repo_timeout,omitempty"`
+}
+
+// OptionsSource is implemented by repository sources that override backup
+// options, see SourceOptions.
+type OptionsSource interface {
+	GetOptions() *SourceOptions
+}
+
+func (o *SourceOptions) GetOptions() *SourceOptions {
+	return o
+}
+
+// Apply copies the options that are set into opts.
+func (o *SourceOptions) Apply(opts *CloneOptions) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if o.BareClone != nil {
+		opts.Bare = *o.BareClone
+	}
+	if o.Depth != nil {
+		opts.Depth = *o.Depth
+	}
+	if o.LFS != nil {
+		opts.LFS = *o.LFS
+	}
+	if o.Prune != nil {
+		opts.Prune = *o.Prune
+	}
+	if o.MaxRetries != nil {
+		opts.Retry.MaxRetries = *o.MaxRetries
+	}
+	if o.RetryBaseDelay != nil {
+		opts.Retry.BaseDelay = *o.RetryBaseDelay
+	}
+	if o.RepoTimeout != nil {
+		opts.Timeout = *o.RepoTimeout
+	}
+	if opts.Bare && opts.NoCheckout {
+		return fmt.Errorf("bare_clone cannot be combined with clone_options.no_checkout, bare clones never check out")
+	}
+	if opts.Bare && opts.SingleBranch {
+		return fmt.Errorf("bare_clone cannot be combined with clone_options.single_branch, bare clones back up every branch")
+	}
+	return nil
+}
+
+func (o *SourceOptions) validate() error {
+	if o.Depth != nil && *o.Depth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+	if o.MaxRetries != nil && *o.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if o.RetryBaseDelay != nil && *o.RetryBaseDelay < 0 {
+		return fmt.Errorf("retry_base_delay must not be negative")
+	}
+	if o.RepoTimeout != nil && *o.RepoTimeout < 0 {
+		return fmt.Errorf("repo_timeout must not be negative")
+	}
+	return nil
+}
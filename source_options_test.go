@@ -0,0 +1,169 @@
+package git_backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSourceOptionsPrecedence checks the order in which main combines the
+// options: a job's own options win over clone_options, which wins over the
+// command line flags, which win over the built-in defaults.
+func TestSourceOptionsPrecedence(t *testing.T) {
+	intPointer := func(i int) *int {
+		return &i
+	}
+	durationPointer := func(d time.Duration) *time.Duration {
+		return &d
+	}
+	tests := []struct {
+		name         string
+		flags        CloneOptions
+		cloneOptions *GitOptions
+		job          SourceOptions
+		want         CloneOptions
+	}{
+		{
+			name: "built-in defaults",
+			want: CloneOptions{},
+		},
+		{
+			name:  "flags override the defaults",
+			flags: CloneOptions{Bare: true, Depth: 5, LFS: true, Prune: true},
+			want:  CloneOptions{Bare: true, Depth: 5, LFS: true, Prune: true},
+		},
+		{
+			name:         "clone_options overrides the depth flag",
+			flags:        CloneOptions{Depth: 5},
+			cloneOptions: &GitOptions{Depth: 10},
+			want:         CloneOptions{Depth: 10},
+		},
+		{
+			name:         "an unset clone_options depth keeps the flag",
+			flags:        CloneOptions{Depth: 5},
+			cloneOptions: &GitOptions{},
+			want:         CloneOptions{Depth: 5},
+		},
+		{
+			name:         "the job overrides clone_options and the flags",
+			flags:        CloneOptions{Depth: 5, LFS: true},
+			cloneOptions: &GitOptions{Depth: 10},
+			job:          SourceOptions{Depth: intPointer(1), LFS: boolPointer(false)},
+			want:         CloneOptions{Depth: 1},
+		},
+		{
+			name:  "the job can turn off what the flags turn on",
+			flags: CloneOptions{Bare: true, Prune: true},
+			job:   SourceOptions{BareClone: boolPointer(false), Prune: boolPointer(false)},
+			want:  CloneOptions{},
+		},
+		{
+			name: "the job can turn on what the flags leave off",
+			job:  SourceOptions{BareClone: boolPointer(true), LFS: boolPointer(true), Prune: boolPointer(true)},
+			want: CloneOptions{Bare: true, LFS: true, Prune: true},
+		},
+		{
+			name:  "a job depth of 0 restores the full history",
+			flags: CloneOptions{Depth: 5},
+			job:   SourceOptions{Depth: intPointer(0)},
+			want:  CloneOptions{},
+		},
+		{
+			name:  "the job overrides the retries and the timeout",
+			flags: CloneOptions{Retry: DefaultRetryPolicy, Timeout: time.Hour},
+			job:   SourceOptions{MaxRetries: intPointer(5), RetryBaseDelay: durationPointer(10 * time.Second), RepoTimeout: durationPointer(0)},
+			want:  CloneOptions{Retry: RetryPolicy{MaxRetries: 5, BaseDelay: 10 * time.Second, MaxDelay: DefaultRetryPolicy.MaxDelay}},
+		},
+		{
+			name:  "unset job options keep the flags",
+			flags: CloneOptions{Bare: true, Depth: 5},
+			job:   SourceOptions{LFS: boolPointer(true)},
+			want:  CloneOptions{Bare: true, Depth: 5, LFS: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.flags
+			if test.cloneOptions != nil {
+				if err := test.cloneOptions.Apply(&opts); err != nil {
+					t.Fatalf("GitOptions.Apply() error = %v", err)
+				}
+			}
+			if err := test.job.GetOptions().Apply(&opts); err != nil {
+				t.Fatalf("SourceOptions.Apply() error = %v", err)
+			}
+			if opts != test.want {
+				t.Errorf("options = %+v, want %+v", opts, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceOptionsInvalid(t *testing.T) {
+	depth := -1
+	negativeDuration := -time.Minute
+	tests := []struct {
+		name  string
+		flags CloneOptions
+		job   SourceOptions
+	}{
+		{name: "negative depth", job: SourceOptions{Depth: &depth}},
+		{name: "negative max retries", job: SourceOptions{MaxRetries: &depth}},
+		{name: "negative repo timeout", job: SourceOptions{RepoTimeout: &negativeDuration}},
+		{name: "bare clone without checkout", flags: CloneOptions{NoCheckout: true}, job: SourceOptions{BareClone: boolPointer(true)}},
+		{name: "bare clone of a single branch", flags: CloneOptions{SingleBranch: true}, job: SourceOptions{BareClone: boolPointer(true)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.flags
+			if err := test.job.Apply(&opts); err == nil {
+				t.Error("Apply() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestGitOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   CloneOptions
+		options GitOptions
+	}{
+		{name: "negative depth", options: GitOptions{Depth: -1}},
+		{name: "bare clone without checkout", flags: CloneOptions{Bare: true}, options: GitOptions{NoCheckout: true}},
+		{name: "bare clone of a single branch", flags: CloneOptions{Bare: true}, options: GitOptions{SingleBranch: true}},
+		{name: "unknown tag mode", options: GitOptions{Tags: "some"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.flags
+			if err := test.options.Apply(&opts); err == nil {
+				t.Error("Apply() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestSourceOptionsYAML(t *testing.T) {
+	config, err := LoadReader(strings.NewReader(`
+gitea:
+  - url: https://gitea.example.com
+    access_token: secret
+    max_retries: 5
+    retry_base_delay: 10s
+    repo_timeout: 1h30m
+`), false)
+	if err != nil {
+		t.Fatalf("LoadReader() error = %v", err)
+	}
+	options := config.Gitea[0].GetOptions()
+	if options.MaxRetries == nil || *options.MaxRetries != 5 {
+		t.Errorf("max_retries = %v, want 5", options.MaxRetries)
+	}
+	if options.RetryBaseDelay == nil || *options.RetryBaseDelay != 10*time.Second {
+		t.Errorf("retry_base_delay = %v, want 10s", options.RetryBaseDelay)
+	}
+	if options.RepoTimeout == nil || *options.RepoTimeout != 90*time.Minute {
+		t.Errorf("repo_timeout = %v, want 1h30m", options.RepoTimeout)
+	}
+}
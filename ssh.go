@@ -0,0 +1,129 @@
+package git_backup
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHConfig holds the ssh settings of a source. Sources clone over ssh when
+// SSH is set or a key is configured.
+type SSHConfig struct {
+	SSH              bool   `yaml:"ssh,omitempty"`
+	SSHKeyPath       string `yaml:"ssh_key_path,omitempty"`
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase,omitempty"`
+	SSHKnownHosts    string `yaml:"ssh_known_hosts,omitempty"`
+}
+
+func (c *SSHConfig) useSSH() bool {
+	return c.SSH || c.SSHKeyPath != ""
+}
+
+func (c *SSHConfig) validate() error {
+	for _, file := range []string{c.SSHKeyPath, c.SSHKnownHosts} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearCredentials drops the passphrase of the ssh key, for ClearCredentials.
+func (c *SSHConfig) clearCredentials() {
+	c.SSHKeyPassphrase = ""
+}
+
+func (c *SSHConfig) sshKey() *SSHKey {
+	return &SSHKey{
+		Path:       c.SSHKeyPath,
+		Passphrase: c.SSHKeyPassphrase,
+		KnownHosts: c.SSHKnownHosts,
+	}
+}
+
+// SSHKey configures public key authentication for ssh clone urls.
+type SSHKey struct {
+	Path       string
+	Passphrase string
+	// KnownHosts is the known_hosts file to verify host keys with. The
+	// default known_hosts files are used when empty.
+	KnownHosts string
+}
+
+// parseGitURL parses a clone url, including scp-like ssh urls such as
+// git@github.com:owner/repo.git, which are turned into ssh:// urls.
+func parseGitURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		if userHost, path, ok := strings.Cut(rawURL, ":"); ok {
+			rawURL = "ssh://" + userHost + "/" + strings.TrimPrefix(path, "/")
+		}
+	}
+	return url.Parse(rawURL)
+}
+
+func (r *Repository) sshAuth(opts CloneOptions) (transport.AuthMethod, error) {
+	user := "git"
+	if r.GitURL.User != nil {
+		user = r.GitURL.User.Username()
+	}
+	key := r.SSHKey
+	if key == nil {
+		key = &SSHKey{}
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case opts.InsecureSkipHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	case key.KnownHosts != "":
+		callback, err := gitssh.NewKnownHostsCallback(key.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		hostKeyCallback = callback
+	}
+
+	if key.Path == "" {
+		agentAuth, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("no ssh key configured and the ssh agent is not available: %w", err)
+		}
+		agentAuth.HostKeyCallback = hostKeyCallback
+		return agentAuth, nil
+	}
+	keyAuth, err := gitssh.NewPublicKeysFromFile(user, key.Path, key.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	keyAuth.HostKeyCallback = hostKeyCallback
+	return keyAuth, nil
+}
+
+// sshCommand is the GIT_SSH_COMMAND for running the git binary with the same
+// key and host key verification as sshAuth. The ssh binary cannot be given
+// the passphrase of a key, so those keys have to be loaded in the ssh agent.
+func (r *Repository) sshCommand(opts CloneOptions) string {
+	command := []string{"ssh", "-o", "BatchMode=yes"}
+	if r.SSHKey != nil && r.SSHKey.Path != "" {
+		command = append(command, "-i", shellQuote(r.SSHKey.Path), "-o", "IdentitiesOnly=yes")
+	}
+	switch {
+	case opts.InsecureSkipHostKey:
+		command = append(command, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	case r.SSHKey != nil && r.SSHKey.KnownHosts != "":
+		command = append(command, "-o", "UserKnownHostsFile="+shellQuote(r.SSHKey.KnownHosts))
+	}
+	return strings.Join(command, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,67 @@
+package git_backup
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// StateFileName is the name of the file in the backup folder that keeps
+// track of repositories between runs.
+const StateFileName = ".git-backup-state.json"
+
+// State is persisted in the backup folder between runs.
+type State struct {
+	Repositories map[string]*RepositoryState `json:"repositories"`
+	// Orphans maps the orphaned backup folders to when they were first
+	// found, so they can be given a grace period before they are removed.
+	Orphans map[string]time.Time `json:"orphans,omitempty"`
+}
+
+type RepositoryState struct {
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	// RemoteFingerprint is the Repository.RemoteFingerprint of the last
+	// successful backup.
+	RemoteFingerprint string `json:"remote_fingerprint,omitempty"`
+}
+
+// LoadState reads the state file at path. A missing file results in an
+// empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{Repositories: make(map[string]*RepositoryState), Orphans: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Orphans == nil {
+		state.Orphans = make(map[string]time.Time)
+	}
+	if state.Repositories == nil {
+		state.Repositories = make(map[string]*RepositoryState)
+	}
+	return state, nil
+}
+
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Repository returns the state of the repository with the given key,
+// creating it when it does not exist yet.
+func (s *State) Repository(key string) *RepositoryState {
+	repoState, ok := s.Repositories[key]
+	if !ok {
+		repoState = &RepositoryState{}
+		s.Repositories[key] = repoState
+	}
+	return repoState
+}
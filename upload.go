@@ -0,0 +1,248 @@
+package git_backup
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultPartSize is the size of the parts of a multipart upload.
+	DefaultPartSize = 64 << 20
+	// MinPartSize is the smallest part S3 accepts, except for the last one.
+	MinPartSize = 5 << 20
+	// maxParts is the most parts S3 accepts for one upload.
+	maxParts = 10000
+)
+
+// Uploader copies a backed up repository, either its folder or its archive,
+// to remote storage under the given key.
+type Uploader interface {
+	Upload(ctx context.Context, localPath string, key string) error
+}
+
+// S3Uploader uploads to an S3 compatible bucket, such as AWS S3 or MinIO.
+// Files larger than PartSize are uploaded in parts, Concurrency at a time.
+// A multipart upload that was cut off, e.g. by a dropped connection, is
+// resumed by the next upload of the same file: the parts that were uploaded
+// already are kept when their content matches.
+type S3Uploader struct {
+	Bucket      string
+	Prefix      string
+	Concurrency int
+	// PartSize is raised for files that would need more parts than S3 allows.
+	PartSize int64
+	client   *minio.Client
+}
+
+// NewS3Uploader connects to the S3 endpoint, e.g. https://s3.amazonaws.com or
+// http://minio.local:9000. The credentials are read from the environment:
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or MINIO_ROOT_USER and
+// MINIO_ROOT_PASSWORD.
+func NewS3Uploader(endpoint, bucket, prefix string, concurrency int, partSize int64) (*S3Uploader, error) {
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		return nil, fmt.Errorf("the s3 part size must be at least %s", FormatSize(MinPartSize))
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	client, err := minio.New(endpointURL.Host, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		}),
+		Secure: endpointURL.Scheme == "https",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Uploader{Bucket: bucket, Prefix: prefix, Concurrency: concurrency, PartSize: partSize, client: client}, nil
+}
+
+func (u *S3Uploader) Upload(ctx context.Context, localPath string, key string) error {
+	return filepath.WalkDir(localPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, filePath)
+		if err != nil {
+			return err
+		}
+		objectName := path.Join(u.Prefix, key, filepath.ToSlash(rel))
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > u.PartSize {
+			err = u.uploadMultipart(ctx, objectName, filePath, info.Size())
+		} else {
+			_, err = u.client.FPutObject(ctx, u.Bucket, objectName, filePath, minio.PutObjectOptions{PartSize: uint64(u.PartSize)})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", objectName, err)
+		}
+		return nil
+	})
+}
+
+// uploadMultipart uploads the file at filePath to objectName in parts. It
+// resumes the newest incomplete upload of objectName, and only uploads the
+// parts that are missing or whose size or md5 don't match the file, which
+// may have changed since.
+func (u *S3Uploader) uploadMultipart(ctx context.Context, objectName, filePath string, size int64) error {
+	core := minio.Core{Client: u.client}
+	partSize := max(u.PartSize, (size+maxParts-1)/maxParts)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	uploadID, uploaded, err := u.incompleteUpload(ctx, objectName)
+	if err != nil {
+		return err
+	}
+	if uploadID == "" {
+		if uploadID, err = core.NewMultipartUpload(ctx, u.Bucket, objectName, minio.PutObjectOptions{}); err != nil {
+			return err
+		}
+	} else {
+		slog.Info("Resuming incomplete upload", "object", objectName, "uploaded_parts", len(uploaded))
+	}
+
+	count := int((size + partSize - 1) / partSize)
+	parts := make([]minio.CompletePart, count)
+	errs := make([]error, count)
+	slots := make(chan struct{}, max(u.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		number, offset := i+1, int64(i)*partSize
+		length := min(partSize, size-offset)
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			section := io.NewSectionReader(file, offset, length)
+			if part, ok := uploaded[number]; ok && part.Size == length {
+				sum := md5.New()
+				if _, err := io.Copy(sum, section); err != nil {
+					errs[i] = err
+					return
+				}
+				if strings.Trim(part.ETag, `"`) == hex.EncodeToString(sum.Sum(nil)) {
+					parts[i] = minio.CompletePart{PartNumber: number, ETag: part.ETag}
+					return
+				}
+				section = io.NewSectionReader(file, offset, length)
+			}
+			part, err := core.PutObjectPart(ctx, u.Bucket, objectName, uploadID, number, section, length, minio.PutObjectPartOptions{})
+			if err != nil {
+				errs[i] = fmt.Errorf("part %d: %w", number, err)
+				return
+			}
+			parts[i] = minio.CompletePart{PartNumber: number, ETag: part.ETag}
+		}()
+	}
+	wg.Wait()
+	// the parts that did make it are kept for the next upload to resume
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	_, err = core.CompleteMultipartUpload(ctx, u.Bucket, objectName, uploadID, parts, minio.PutObjectOptions{})
+	return err
+}
+
+// incompleteUpload returns the id and the uploaded parts of the newest
+// incomplete multipart upload of objectName, or an empty id when there is
+// none.
+func (u *S3Uploader) incompleteUpload(ctx context.Context, objectName string) (string, map[int]minio.ObjectPart, error) {
+	var newest minio.ObjectMultipartInfo
+	for upload := range u.client.ListIncompleteUploads(ctx, u.Bucket, objectName, true) {
+		if upload.Err != nil {
+			return "", nil, upload.Err
+		}
+		if upload.Key == objectName && (newest.UploadID == "" || upload.Initiated.After(newest.Initiated)) {
+			newest = upload
+		}
+	}
+	if newest.UploadID == "" {
+		return "", nil, nil
+	}
+	core := minio.Core{Client: u.client}
+	parts := make(map[int]minio.ObjectPart)
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, u.Bucket, objectName, newest.UploadID, marker, 1000)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, part := range result.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated {
+			return newest.UploadID, parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// AbortIncompleteUploads aborts the multipart uploads under Prefix that were
+// started more than olderThan ago and never completed, and returns their
+// object names. Their parts are stored, and paid for, until they are aborted.
+func (u *S3Uploader) AbortIncompleteUploads(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-olderThan)
+	abandoned := make([]minio.ObjectMultipartInfo, 0)
+	for upload := range u.client.ListIncompleteUploads(ctx, u.Bucket, u.Prefix, true) {
+		if upload.Err != nil {
+			return nil, upload.Err
+		}
+		if upload.Initiated.Before(cutoff) {
+			abandoned = append(abandoned, upload)
+		}
+	}
+	core := minio.Core{Client: u.client}
+	aborted := make([]string, 0, len(abandoned))
+	for _, upload := range abandoned {
+		if err := core.AbortMultipartUpload(ctx, u.Bucket, upload.Key, upload.UploadID); err != nil {
+			return aborted, fmt.Errorf("abort the upload of %s: %w", upload.Key, err)
+		}
+		aborted = append(aborted, upload.Key)
+	}
+	return aborted, nil
+}
+
+// Test checks that the bucket exists and the credentials give access to it.
+func (u *S3Uploader) Test(ctx context.Context) error {
+	exists, err := u.client.BucketExists(ctx, u.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", u.Bucket)
+	}
+	return nil
+}
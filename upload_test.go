@@ -0,0 +1,250 @@
+package git_backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+// fakeS3 serves the part of the S3 api used by S3Uploader for one bucket.
+type fakeS3 struct {
+	t        *testing.T
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]*fakeUpload
+	putParts []int
+	nextID   int
+}
+
+func (s *fakeS3) startUpload(key string, initiated time.Time, parts map[int][]byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.uploads[id] = &fakeUpload{key: key, initiated: initiated, parts: parts}
+	return id
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Error(err)
+	}
+	writeXML := func(v any) {
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(v)
+	}
+	upload := s.uploads[query.Get("uploadId")]
+	if query.Has("uploadId") && upload == nil {
+		http.Error(w, "no such upload", http.StatusNotFound)
+		return
+	}
+	etag := func(data []byte) string {
+		sum := md5.Sum(data)
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Has("uploads"):
+		type uploadXML struct {
+			Key       string
+			UploadId  string
+			Initiated time.Time
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+			IsTruncated bool
+			Upload      []uploadXML
+		}{}
+		for id, upload := range s.uploads {
+			if strings.HasPrefix(upload.key, query.Get("prefix")) {
+				result.Upload = append(result.Upload, uploadXML{Key: upload.key, UploadId: id, Initiated: upload.initiated})
+			}
+		}
+		writeXML(result)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &fakeUpload{key: key, initiated: time.Now(), parts: make(map[int][]byte)}
+		writeXML(struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Key      string
+			UploadId string
+		}{Key: key, UploadId: id})
+	case r.Method == http.MethodPut && upload != nil:
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[number] = body
+		s.putParts = append(s.putParts, number)
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet && upload != nil:
+		type partXML struct {
+			PartNumber int
+			ETag       string
+			Size       int64
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListPartsResult"`
+			IsTruncated bool
+			Part        []partXML
+		}{}
+		for number, data := range upload.parts {
+			result.Part = append(result.Part, partXML{PartNumber: number, ETag: etag(data), Size: int64(len(data))})
+		}
+		sort.Slice(result.Part, func(i, j int) bool { return result.Part[i].PartNumber < result.Part[j].PartNumber })
+		writeXML(result)
+	case r.Method == http.MethodPost && upload != nil:
+		var complete struct {
+			Part []struct {
+				PartNumber int
+				ETag       string
+			}
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			s.t.Error(err)
+		}
+		var object []byte
+		for _, part := range complete.Part {
+			data, ok := upload.parts[part.PartNumber]
+			if !ok || strings.Trim(part.ETag, `"`) != strings.Trim(etag(data), `"`) {
+				http.Error(w, "invalid part", http.StatusBadRequest)
+				return
+			}
+			object = append(object, data...)
+		}
+		s.objects[key] = object
+		delete(s.uploads, query.Get("uploadId"))
+		writeXML(struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: "backups", Key: key, ETag: etag(object)})
+	case r.Method == http.MethodDelete && upload != nil:
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", etag(body))
+	default:
+		s.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func newFakeS3Uploader(t *testing.T, partSize int64) (*S3Uploader, *fakeS3) {
+	t.Helper()
+	s3 := &fakeS3{t: t, objects: make(map[string][]byte), uploads: make(map[string]*fakeUpload)}
+	// over tls the client sends plain bodies rather than signed chunks
+	server := httptest.NewTLSServer(s3)
+	t.Cleanup(server.Close)
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:     credentials.NewStaticV4("access", "secret", ""),
+		Secure:    true,
+		Region:    "us-east-1",
+		Transport: server.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &S3Uploader{Bucket: "backups", Prefix: "git", Concurrency: 2, PartSize: partSize, client: client}, s3
+}
+
+func TestS3UploaderResumesMultipartUpload(t *testing.T) {
+	uploader, s3 := newFakeS3Uploader(t, 1024)
+	localPath := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 290) // 4640 bytes, 5 parts
+	if err := os.WriteFile(filepath.Join(localPath, "repo.tar.gz"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(localPath, "RESTORE.md"), []byte("# restore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a previous run got the first two parts through, the third one changed since
+	s3.startUpload("git/github/repo.tar.gz", time.Now().Add(-time.Hour), map[int][]byte{
+		1: content[:1024],
+		2: content[1024:2048],
+		3: bytes.Repeat([]byte("x"), 1024),
+	})
+
+	if err := uploader.Upload(context.Background(), localPath, "github"); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if got := s3.objects["git/github/repo.tar.gz"]; !bytes.Equal(got, content) {
+		t.Errorf("uploaded %d bytes, want the %d bytes of the file", len(got), len(content))
+	}
+	if got := string(s3.objects["git/github/RESTORE.md"]); got != "# restore\n" {
+		t.Errorf("RESTORE.md = %q, want it uploaded in one piece", got)
+	}
+	slices.Sort(s3.putParts)
+	if want := []int{3, 4, 5}; !slices.Equal(s3.putParts, want) {
+		t.Errorf("uploaded parts %v, want %v", s3.putParts, want)
+	}
+	if len(s3.uploads) != 0 {
+		t.Errorf("%d uploads are left incomplete, want 0", len(s3.uploads))
+	}
+}
+
+func TestS3UploaderAbortIncompleteUploads(t *testing.T) {
+	uploader, s3 := newFakeS3Uploader(t, 1024)
+	s3.startUpload("git/github/abandoned.tar.gz", time.Now().Add(-8*24*time.Hour), map[int][]byte{1: []byte("part")})
+	recent := s3.startUpload("git/github/recent.tar.gz", time.Now().Add(-time.Hour), map[int][]byte{1: []byte("part")})
+	// outside of the prefix, it belongs to someone else
+	other := s3.startUpload("other/old.tar.gz", time.Now().Add(-30*24*time.Hour), nil)
+
+	aborted, err := uploader.AbortIncompleteUploads(context.Background(), 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("AbortIncompleteUploads() error = %v", err)
+	}
+	if want := []string{"git/github/abandoned.tar.gz"}; !slices.Equal(aborted, want) {
+		t.Errorf("AbortIncompleteUploads() = %v, want %v", aborted, want)
+	}
+	remaining := make([]string, 0, len(s3.uploads))
+	for id := range s3.uploads {
+		remaining = append(remaining, id)
+	}
+	slices.Sort(remaining)
+	if want := []string{recent, other}; !slices.Equal(remaining, want) {
+		t.Errorf("remaining uploads %v, want %v", remaining, want)
+	}
+}
+
+func TestNewS3UploaderPartSize(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "access")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if _, err := NewS3Uploader("s3.amazonaws.com", "backups", "", 4, 1<<20); err == nil {
+		t.Error("NewS3Uploader() with a 1MB part size succeeded, want an error")
+	}
+	uploader, err := NewS3Uploader("s3.amazonaws.com", "backups", "", 4, 0)
+	if err != nil {
+		t.Fatalf("NewS3Uploader() error = %v", err)
+	}
+	if uploader.PartSize != DefaultPartSize {
+		t.Errorf("PartSize = %d, want %d", uploader.PartSize, DefaultPartSize)
+	}
+}
@@ -1,5 +1,70 @@
 package git_backup
 
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
 func boolPointer(b bool) *bool {
 	return &b
 }
+
+// copyDir recursively copies the contents of src into the existing directory dst.
+func copyDir(src string, dst string) error {
+	return copyTree(src, dst, nil)
+}
+
+// copyTree copies src into dst like copyDir, but hard links the files for
+// which hardLink returns true, falling back to copying them when linking fails.
+func copyTree(src string, dst string, hardLink func(rel string) bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case hardLink != nil && hardLink(rel):
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
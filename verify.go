@@ -0,0 +1,21 @@
+package git_backup
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// VerifyRepository checks the integrity of the repository at path with
+// git fsck, which catches corruption that a successful fetch does not.
+// go-git has no equivalent, so this requires git.
+func VerifyRepository(path string) error {
+	gitBinary, err := exec.LookPath("git")
+	if err != nil {
+		return fmt.Errorf("verifying repositories requires git to be installed: %w", err)
+	}
+	cmd := exec.Command(gitBinary, "-C", path, "fsck", "--full", "--no-progress")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fsck failed: %w: %s", err, output)
+	}
+	return nil
+}
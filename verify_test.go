@@ -0,0 +1,50 @@
+package git_backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestVerifyRepository(t *testing.T) {
+	requireGit(t)
+	path, _ := newTestRepository(t, map[string]string{"README.md": "# test\n"})
+	if err := VerifyRepository(path); err != nil {
+		t.Errorf("VerifyRepository() of a healthy repository error = %v", err)
+	}
+}
+
+func TestVerifyRepositoryCorrupted(t *testing.T) {
+	requireGit(t)
+	path, commit := newTestRepository(t, map[string]string{"README.md": "# test\n"})
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitObject, err := gitRepo.CommitObject(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptObject(t, path, commitObject.TreeHash)
+
+	if err := VerifyRepository(path); err == nil {
+		t.Error("VerifyRepository() of a corrupted repository error = nil, want an error")
+	}
+}
+
+// corruptObject overwrites the loose object hash of the repository at path
+// with garbage.
+func corruptObject(t *testing.T, path string, hash plumbing.Hash) {
+	t.Helper()
+	objectPath := filepath.Join(path, ".git", "objects", hash.String()[:2], hash.String()[2:])
+	// loose objects are written read-only
+	if err := os.Chmod(objectPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(objectPath, []byte("not a git object"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}